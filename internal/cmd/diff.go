@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/plant99/baler/pkg/baler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+)
+
+// useColor resolves --color, 'auto' colors output to a terminal
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == "", nil
+	}
+	return false, baler.NewConfigError(fmt.Sprintf("unknown color mode: %s. Use 'auto', 'always' or 'never'", mode), nil)
+}
+
+// colorizeDiff colors the lines of a unified diff like git does
+func colorizeDiff(diff string) string {
+	var builder strings.Builder
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		color := ""
+		switch {
+		case strings.HasPrefix(line, "diff --git "), strings.HasPrefix(line, "new file mode "),
+			strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			color = colorBold
+		case strings.HasPrefix(line, "@@"):
+			color = colorCyan
+		case strings.HasPrefix(line, "+"):
+			color = colorGreen
+		case strings.HasPrefix(line, "-"):
+			color = colorRed
+		}
+		if color == "" || line == "" {
+			builder.WriteString(line)
+			continue
+		}
+		builder.WriteString(color + strings.TrimSuffix(line, "\n") + colorReset)
+		if strings.HasSuffix(line, "\n") {
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+// formatDiffStat formats a summary of the diffs like 'git diff --stat'
+func formatDiffStat(diffs []baler.FileDiff, color bool) string {
+	const maxBarWidth = 40
+	var builder strings.Builder
+	pathWidth, countWidth, maxChanges := 0, 0, 0
+	insertions := make([]int, len(diffs))
+	deletions := make([]int, len(diffs))
+	for i := range diffs {
+		insertions[i], deletions[i] = diffs[i].Stat()
+		pathWidth = max(pathWidth, len(diffs[i].Path))
+		maxChanges = max(maxChanges, insertions[i]+deletions[i])
+	}
+	countWidth = len(fmt.Sprint(maxChanges))
+	totalInsertions, totalDeletions := 0, 0
+	for i, diff := range diffs {
+		plus, minus := insertions[i], deletions[i]
+		// scale the bar down for large changes
+		if maxChanges > maxBarWidth {
+			plus = (plus*maxBarWidth + maxChanges - 1) / maxChanges
+			minus = (minus*maxBarWidth + maxChanges - 1) / maxChanges
+		}
+		bar := strings.Repeat("+", plus)
+		if color && plus > 0 {
+			bar = colorGreen + bar + colorReset
+		}
+		if color && minus > 0 {
+			bar += colorRed + strings.Repeat("-", minus) + colorReset
+		} else {
+			bar += strings.Repeat("-", minus)
+		}
+		builder.WriteString(fmt.Sprintf(" %-*s | %*d %s\n", pathWidth, diff.Path, countWidth, insertions[i]+deletions[i], bar))
+		totalInsertions += insertions[i]
+		totalDeletions += deletions[i]
+	}
+	builder.WriteString(fmt.Sprintf(
+		" %s changed, %s(+), %s(-)\n",
+		plural(len(diffs), "file"), plural(totalInsertions, "insertion"), plural(totalDeletions, "deletion"),
+	))
+	return builder.String()
+}
+
+// plural formats a count with its noun, like git: "1 file", "2 files"
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+func newDiffCommand() *cobra.Command {
+	var maxInputFileSize, maxBufferSize uint64
+	var fileDelimiter, format, color string
+	var contextLines int
+	var stat, verbose, skipUnsafePaths bool
+	var diffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Show the changes 'baler unconvert' would make to a directory.",
+		Long: `Show the changes 'baler unconvert' would make to a directory as a unified diff.
+
+Arguments: <converted-files-directory> <destination-directory>
+
+The output files are parsed exactly like 'baler unconvert' does. 'a/' is the file in the
+destination directory, 'b/' the file in the output files. Files which would be created
+are compared with /dev/null, files missing from the output files are left out as
+'baler unconvert' doesn't remove them. Files which 'baler unconvert' can't write fail
+the diff.
+
+e.g/
+
+$ baler diff output_directory/ code_directory/
+$ baler diff --stat output_directory/ code_directory/
+		`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			// logs are written to stderr, the diff to stdout
+			config := &baler.BalerConfig{
+				MaxBufferSize:    maxBufferSize,
+				MaxInputFileSize: maxInputFileSize,
+				Operation:        baler.OperationUnconvert,
+				FileDelimiter:    fileDelimiter,
+				Logger:           newTextLogger(cmd, verbose),
+				Verbose:          verbose,
+				SkipUnsafePaths:  skipUnsafePaths,
+			}
+			outputFormat, balerErr := baler.ParseOutputFormat(format)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			config.Format = outputFormat
+			colored, err := useColor(color)
+			if err != nil {
+				handleError(cmd, err)
+			}
+			if contextLines < 0 {
+				handleError(cmd, baler.NewConfigError("--unified can't be negative", nil))
+			}
+			diffs, balerErr := baler.Diff(cmd.Context(), baler.NewDirBundleReader(args[0]), baler.NewDirFS(args[1]), config)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			if stat {
+				if len(diffs) > 0 {
+					fmt.Fprint(cmd.OutOrStdout(), formatDiffStat(diffs, colored))
+				}
+				return
+			}
+			for _, diff := range diffs {
+				unified := diff.Unified(contextLines)
+				if colored {
+					unified = colorizeDiff(unified)
+				}
+				fmt.Fprint(cmd.OutOrStdout(), unified)
+			}
+		},
+	}
+	diffCmd.Flags().Uint64VarP(&maxInputFileSize, "max-input-file-size", "i", 5*1024*1024, "Set maximum size (in bytes) of the input file(s).")
+	diffCmd.Flags().Uint64VarP(&maxBufferSize, "max-buffer-size", "b", 0, "Set maximum size (in bytes) of buffer for read operations.")
+	diffCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Run baler in verbose mode.")
+	diffCmd.Flags().StringVarP(&fileDelimiter, "delimiter", "d", "// filename: ", "Text that separates 2 files in the converted files, 'auto' detects it.")
+	diffCmd.Flags().StringVarP(&format, "format", "f", string(baler.FormatAuto), "Format of the converted files. One of 'auto', 'text', 'markdown', 'xml', 'jsonl'.")
+	diffCmd.Flags().IntVarP(&contextLines, "unified", "U", 3, "Number of unchanged lines shown around every change.")
+	diffCmd.Flags().BoolVar(&stat, "stat", false, "Only show the number of changed lines per file.")
+	diffCmd.Flags().StringVar(&color, "color", "auto", "Color the output. One of 'auto', 'always', 'never'.")
+	diffCmd.Flags().BoolVar(&skipUnsafePaths, "skip-unsafe-paths", false, "Skip files with absolute paths, '..' or links outside the directory with a warning, instead of failing.")
+	return diffCmd
+}
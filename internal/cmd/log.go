@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/plant99/baler/pkg/baler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logLevels are the values of --log-level
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// cliLogger writes the messages of baler to stderr, with --log-format
+type cliLogger struct {
+	*slog.Logger
+	writer io.Writer
+	// cleared before every message, nil without a progress bar
+	progress *progressBar
+}
+
+// newLogger returns the logger of --log-format and --log-level, --verbose
+// lowers the level to 'info'
+func newLogger(cmd *cobra.Command, format string, level string, verbose bool) (*cliLogger, *baler.BalerError) {
+	minLevel, ok := logLevels[level]
+	if !ok {
+		return nil, baler.NewConfigError(
+			fmt.Sprintf("unknown log level: %s. Supported levels are 'debug', 'info', 'warn' and 'error'", level),
+			nil,
+		)
+	}
+	if verbose && minLevel > slog.LevelInfo {
+		minLevel = slog.LevelInfo
+	}
+	logger := &cliLogger{writer: cmd.ErrOrStderr()}
+	var handler slog.Handler
+	switch format {
+	case logFormatText:
+		handler = &textHandler{writer: logger, level: minLevel}
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(logger, &slog.HandlerOptions{Level: minLevel})
+	default:
+		return nil, baler.NewConfigError(
+			fmt.Sprintf("unknown log format: %s. Supported formats are '%s' and '%s'", format, logFormatText, logFormatJSON),
+			nil,
+		)
+	}
+	logger.Logger = slog.New(handler)
+	return logger, nil
+}
+
+// newTextLogger returns the logger of commands without --log-format and
+// --log-level, which can't fail
+func newTextLogger(cmd *cobra.Command, verbose bool) *cliLogger {
+	logger, _ := newLogger(cmd, logFormatText, "warn", verbose)
+	return logger
+}
+
+// verbose returns whether info messages are logged, i.e/ BalerConfig.Verbose
+func (l *cliLogger) verbose() bool {
+	return l.Enabled(context.Background(), slog.LevelInfo)
+}
+
+// Write is called by the handler once per message
+func (l *cliLogger) Write(p []byte) (int, error) {
+	l.progress.clear()
+	return l.writer.Write(p)
+}
+
+// textHandler writes a message per line, e.g/
+//
+//	warn: Skipping file path=docs/link.md reason=error error="unable to read: docs/link.md"
+type textHandler struct {
+	writer io.Writer
+	level  slog.Level
+	// attributes of WithAttrs, already formatted
+	attrs []byte
+	// prefix of the keys, from WithGroup
+	group string
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, record slog.Record) error {
+	buf := []byte(strings.ToLower(record.Level.String()) + ": " + record.Message)
+	buf = append(buf, h.attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		buf = appendAttr(buf, h.group, attr)
+		return true
+	})
+	buf = append(buf, '\n')
+	_, err := h.writer.Write(buf)
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	handler.attrs = append([]byte{}, h.attrs...)
+	for _, attr := range attrs {
+		handler.attrs = appendAttr(handler.attrs, h.group, attr)
+	}
+	return &handler
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	handler := *h
+	handler.group = h.group + name + "."
+	return &handler
+}
+
+// appendAttr appends " key=value", values are quoted when they contain
+// spaces or quotes, and groups are flattened to "group.key=value"
+func appendAttr(buf []byte, group string, attr slog.Attr) []byte {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return buf
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			group += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			buf = appendAttr(buf, group, member)
+		}
+		return buf
+	}
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\r\"=\\") || !utf8.ValidString(value) {
+		value = strconv.Quote(value)
+	}
+	return append(buf, " "+group+attr.Key+"="+value...)
+}
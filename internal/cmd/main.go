@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
-	"github.com/plant99/baler/internal/baler"
+	"github.com/plant99/baler/pkg/baler"
 	"github.com/spf13/cobra"
 )
 
@@ -15,17 +20,24 @@ var BalerCommand = &cobra.Command{
 
 func Run() {
 	AddCommands()
-	BalerCommand.Execute()
+	// the first Ctrl-C cancels the command, which removes its partial
+	// output, and the next one exits right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	BalerCommand.ExecuteContext(ctx)
 }
 
 func AddCommands() {
 	// version command
-	version := "0.0.1-b0"
 	var versionCmd = &cobra.Command{
 		Use:   "version",
 		Short: "Show the version of baler",
 		Run: func(cmd *cobra.Command, args []string) {
-			cmd.Println("baler: ", version)
+			cmd.Println("baler: ", baler.Version)
 		},
 	}
 
@@ -33,10 +45,22 @@ func AddCommands() {
 	var convertMaxInputFileSize, unconvertMaxInputFileSize uint64
 	var maxInputFileLines uint64
 	var maxOutputFileSize uint64
+	var maxInputFileTokens, maxOutputTokens uint64
+	var tokenizerName, tokenizerVocab string
 	var convertMaxBufferSize, unconvertMaxBufferSize uint64
-	var exclusionPatterns []string
+	var exclusionPatterns, inclusionPatterns, priorityPatterns []string
+	var order string
+	var jobs int
 	var convertFileDelimiter, unconvertFileDelimiter string
+	var convertFormat, unconvertFormat string
 	var convertVerbose, unconvertVerbose bool
+	var noIgnoreFiles, overwrite, tree bool
+	var dryRun, skipUnsafePaths bool
+	var convertIgnoreErrors, ignoreErrors bool
+	var convertNoProgress, unconvertNoProgress bool
+	var convertLogFormat, unconvertLogFormat, convertLogLevel, unconvertLogLevel string
+	var backupDir string
+	var convertReport, unconvertReport string
 	var convertCmd = &cobra.Command{
 		Use:   "convert",
 		Short: "Convert a directory into smaller text files.",
@@ -45,10 +69,54 @@ func AddCommands() {
 Arguments: <source-files-directory> <converted-files-directory>
 
 
+Formats:
+	- text: each file is preceded by --delimiter and its path
+	- markdown: each file is a '### <path>' heading followed by a fenced code block
+	- xml: each file is a <document path="<path>"> element wrapping a CDATA section
+	- jsonl: each file is a JSON object on its own line, with path, content, size, mode, sha256 and language
+
+Include Patterns:
+	- When --include is specified, only files matching one of the patterns are converted
+	- --exclude patterns and ignore files take precedence over --include
+
+Order:
+	- Files are sorted by path unless --order is specified
+	- Files matching a --priority pattern come first, in the order of the patterns
+	- Identical source directories give identical output files
+
+Directory Tree:
+	- With --tree, output_0.txt begins with the directory tree of the converted files,
+	  with their line count and size, or why they were skipped
+	- The tree is ignored by 'unconvert'
+
+Ignore Files:
+	- Rules from .gitignore and .balerignore files in the source directory
+	  and its sub-directories are applied in addition to --exclude
+	- .git directories are skipped, and .git/info/exclude is applied
+	- Use --no-ignore-files to disable this behavior
+
 Size Handling:
 	- Input files larger than --max-input-file-size are skipped
 	- Output files are split when they reach --max-output-file-size
 	- Read/Write buffer size defaults to "--max-input-file-size" if not specified
+	- Files are read and validated by --jobs workers, and written in order by a single writer
+
+Token Handling:
+	- Input files with more tokens than --max-input-file-tokens are skipped
+	- Output files are split before they exceed --max-output-tokens
+	- --max-input-file-tokens defaults to --max-output-tokens if not specified
+
+Output Files:
+	- Use '-' as <converted-files-directory> to write a single stream to stdout, which isn't
+	  split by size or tokens, and has no manifest
+	- Output files are moved into the destination directory once all of them are complete
+	- A previous output, listed in baler.manifest.json, is only replaced with --overwrite
+
+Errors:
+	- By default, baler stops at the first file or directory which can't be read
+	- With --ignore-errors, they are skipped and listed once done, and baler exits with status 2
+	- Ctrl-C removes the output files written so far, and baler exits with status 130
+	- --report is written in any case, with the error which stopped baler if any
 
 e.g/
 
@@ -56,18 +124,44 @@ $ baler convert code_directory/ output_directory/
 		`,
 		Args: cobra.ExactArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
+			ignoreFileNames := []string{".gitignore", ".balerignore"}
+			if noIgnoreFiles {
+				ignoreFileNames = []string{}
+			}
 			config := &baler.BalerConfig{
 				MaxInputFileLines: maxInputFileLines,
 				MaxInputFileSize:  convertMaxInputFileSize,
 				MaxOutputFileSize: maxOutputFileSize,
 				MaxBufferSize:     convertMaxBufferSize,
 				ExclusionPatterns: &exclusionPatterns,
+				IncludePatterns:   &inclusionPatterns,
+				IgnoreFileNames:   &ignoreFileNames,
 				Operation:         baler.OperationConvert,
 				FileDelimiter:     convertFileDelimiter,
-				Logger:            newCobraLogger(cmd, convertVerbose),
-				Verbose:           convertVerbose,
+				Overwrite:         overwrite,
+				IgnoreErrors:      convertIgnoreErrors,
+				PriorityPatterns:  &priorityPatterns,
+				Tree:              tree,
+				Jobs:              jobs,
+				Report:            newReport(convertReport),
 			}
 			// validation
+			logger, balerErr := newLogger(cmd, convertLogFormat, convertLogLevel, convertVerbose)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			config.Logger = logger
+			config.Verbose = logger.verbose()
+			format, balerErr := baler.ParseOutputFormat(convertFormat)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			config.Format = format
+			fileOrder, balerErr := baler.ParseFileOrder(order)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			config.Order = fileOrder
 			if config.MaxInputFileSize >= config.MaxOutputFileSize {
 				handleError(
 					cmd,
@@ -78,19 +172,70 @@ $ baler convert code_directory/ output_directory/
 					),
 				)
 			}
-			// TODO: get output file list
-			_, err := baler.Convert(args[0], args[1], config)
+			if maxInputFileTokens == 0 {
+				maxInputFileTokens = maxOutputTokens
+			}
+			if maxOutputTokens > 0 && maxInputFileTokens > maxOutputTokens {
+				handleError(
+					cmd,
+					fmt.Errorf(
+						"--max-input-file-tokens = %d cannot be > --max-output-tokens = %d",
+						maxInputFileTokens,
+						maxOutputTokens,
+					),
+				)
+			}
+			if maxInputFileTokens > 0 || maxOutputTokens > 0 {
+				tokenizer, err := newTokenizer(tokenizerName, tokenizerVocab)
+				if err != nil {
+					handleError(cmd, err)
+				}
+				config.Tokenizer = tokenizer
+				config.MaxInputFileTokens = maxInputFileTokens
+				config.MaxOutputTokens = maxOutputTokens
+			}
+			progress := newProgressBar(cmd, !config.Verbose && !convertNoProgress)
+			progress.observe(config)
+			var processedPaths *[]string
+			var err *baler.BalerError
+			if args[1] == "-" {
+				// messages are printed to stderr, and don't mix with the stream
+				processedPaths, err = baler.Convert(cmd.Context(), baler.NewDirFS(args[0]), baler.NewStreamBundleWriter(cmd.OutOrStdout()), config)
+			} else {
+				processedPaths, err = baler.ConvertDir(cmd.Context(), args[0], args[1], config)
+			}
+			progress.clear()
+			if balerErr := writeReport(convertReport, config.Report); balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			if err != nil && err.Type != baler.ErrorTypePartial {
+				handleError(cmd, err)
+			}
+			if err != nil {
+				cmd.Printf("Conversion completed with errors! Processed %d paths.\n", len(*processedPaths))
+			} else {
+				cmd.Printf("Conversion successful! Processed %d paths.\n", len(*processedPaths))
+			}
+			if args[1] != "-" {
+				cmd.Printf("Manifest: %s\n", filepath.Join(args[1], baler.ManifestFileName))
+			}
 			if err != nil {
+				// exits with the list of skipped files
 				handleError(cmd, err)
 			}
-			cmd.Println("Conversion successful!")
 		},
 	}
 	convertCmd.Flags().Uint64VarP(&convertMaxInputFileSize, "max-input-file-size", "i", 1*1024*1024, "Set maximum file size (in bytes) to be considered while converting.")
 	convertCmd.Flags().Uint64VarP(&maxInputFileLines, "max-input-file-lines", "l", 10000, "Set maximum lines a file can have to be considered while converting.")
 	convertCmd.Flags().Uint64VarP(&maxOutputFileSize, "max-output-file-size", "o", 5*1024*1024, "Set maximum size (in bytes) of the generated output file.")
 	convertCmd.Flags().Uint64VarP(&convertMaxBufferSize, "max-buffer-size", "b", 0, "Set maximum size (in bytes) of buffer for copy operation.")
-	convertCmd.Flags().BoolVarP(&convertVerbose, "verbose", "v", false, "Run baler in verbose mode.")
+	convertCmd.Flags().Uint64Var(&maxInputFileTokens, "max-input-file-tokens", 0, "Set maximum tokens a file can have to be considered while converting.")
+	convertCmd.Flags().Uint64Var(&maxOutputTokens, "max-output-tokens", 0, "Set maximum tokens of the generated output file.")
+	convertCmd.Flags().StringVar(&tokenizerName, "tokenizer", baler.TokenizerBPE, "Tokenizer used to count tokens. One of 'bpe', 'estimate'.")
+	convertCmd.Flags().StringVar(&tokenizerVocab, "tokenizer-vocab", "", "Path to a tiktoken rank file (e.g/ cl100k_base.tiktoken) for the 'bpe' tokenizer.")
+	convertCmd.Flags().BoolVarP(&convertVerbose, "verbose", "v", false, "Run baler in verbose mode, same as '--log-level info'.")
+	convertCmd.Flags().StringVar(&convertLogFormat, "log-format", logFormatText, "Format of the messages written to stderr. One of 'text', 'json'.")
+	convertCmd.Flags().StringVar(&convertLogLevel, "log-level", "warn", "Minimum level of the messages written to stderr. One of 'debug', 'info', 'warn', 'error'.")
 	convertCmd.Flags().StringVarP(
 		&convertFileDelimiter,
 		"delimiter",
@@ -98,10 +243,24 @@ $ baler convert code_directory/ output_directory/
 		"// filename: ",
 		`Text that separates 2 files in the generated file.
 Note that this delimiter is ALWAYS.
-	- prefixed by a new line ("\n")
-	- suffixed by the next file name and a new line ("\n")`,
+	- at the beginning of a line
+	- suffixed by the next file name and a new line ("\n")
+Every file is terminated by a new line ("\n"), which is dropped by 'unconvert'.
+Lines of a file beginning with the delimiter are escaped with a '\'.
+'auto' picks a delimiter like "// filename: " which doesn't begin any line.`,
 	)
+	convertCmd.Flags().StringVarP(&convertFormat, "format", "f", string(baler.FormatText), "Format of the generated files. One of 'text', 'markdown', 'xml', 'jsonl'.")
 	convertCmd.Flags().StringSliceVarP(&exclusionPatterns, "exclude", "e", []string{}, "A list of exclusion patterns for baler. e.g '-e \"node_modules*\" -e \"poetry.*\" -e \"package.*\"'")
+	convertCmd.Flags().StringSliceVarP(&inclusionPatterns, "include", "I", []string{}, "A list of inclusion patterns for baler. Only matching files are converted. e.g '-I \"internal/**/*.go\" -I \"*.md\"'")
+	convertCmd.Flags().StringVar(&order, "order", string(baler.OrderPath), "Order of the files in the generated files. One of 'path', 'breadth-first', 'size', 'mtime'.")
+	convertCmd.Flags().StringSliceVar(&priorityPatterns, "priority", []string{}, "A list of patterns for files which come first, in the order of the patterns. e.g '--priority README.md --priority go.mod'")
+	convertCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "Number of files read and validated concurrently. Defaults to the number of CPUs.")
+	convertCmd.Flags().BoolVar(&tree, "tree", false, "Write the directory tree, with the size of files or why they were skipped, at the beginning of the first generated file.")
+	convertCmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace the output files of a previous convert, listed in its baler.manifest.json.")
+	convertCmd.Flags().BoolVar(&convertIgnoreErrors, "ignore-errors", false, "Skip files and directories which can't be read, and list them once done, instead of failing.")
+	convertCmd.Flags().StringVar(&convertReport, "report", "", "Write a JSON report of the converted and skipped files, output files and timings to this path.")
+	convertCmd.Flags().BoolVar(&convertNoProgress, "no-progress", false, "Don't show a progress bar when stderr is a terminal.")
+	convertCmd.Flags().BoolVar(&noIgnoreFiles, "no-ignore-files", false, "Don't apply rules from .gitignore and .balerignore files.")
 
 	// unconvert a group of files into directory
 	var unconvertCmd = &cobra.Command{
@@ -113,6 +272,28 @@ Arguments: <converted-files-directory> <source-files-directory>
 
 Buffer size defaults to input file size if not specified.
 
+The format of every file is detected unless --format is specified.
+
+Nothing is written when a file conflicts with the destination directory, e.g/ when
+its path is a directory. Use --dry-run to list what would be done.
+
+Files are written into a staging directory first, and moved into place once all the
+output files are read. If a file can't be moved into place, the files moved before it
+are rolled back. Use --backup-dir to keep a copy of the overwritten files.
+
+Paths which are absolute, contain '..', or lead outside the destination directory
+through symbolic links are rejected, unless --skip-unsafe-paths is specified.
+
+Use '-' as <converted-files-directory> to read output files from stdin, e.g/ the reply of
+a model. The whole stream is parsed before anything is written.
+
+With --ignore-errors, output files which can't be parsed and files which can't be
+written are skipped, listed once done, and baler exits with status 2.
+
+Ctrl-C rolls back the files moved into place, and baler exits with status 130.
+
+--report is written in any case, with the error which stopped baler if any.
+
 e.g/
 
 $ baler unconvert output_directory/ new_code_directory/
@@ -124,11 +305,51 @@ $ baler unconvert output_directory/ new_code_directory/
 				MaxInputFileSize: unconvertMaxInputFileSize,
 				Operation:        baler.OperationUnconvert,
 				FileDelimiter:    unconvertFileDelimiter,
-				Logger:           newCobraLogger(cmd, unconvertVerbose),
-				Verbose:          unconvertVerbose,
+				SkipUnsafePaths:  skipUnsafePaths,
+				BackupDir:        backupDir,
+				IgnoreErrors:     ignoreErrors,
+				Report:           newReport(unconvertReport),
+			}
+			logger, balerErr := newLogger(cmd, unconvertLogFormat, unconvertLogLevel, unconvertVerbose)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			config.Logger = logger
+			config.Verbose = logger.verbose()
+			format, balerErr := baler.ParseOutputFormat(unconvertFormat)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			config.Format = format
+			if dryRun && unconvertReport != "" {
+				handleError(cmd, baler.NewConfigError("--report can't be used with --dry-run", nil))
+			}
+			if dryRun {
+				plan, err := baler.PlanUnConvert(cmd.Context(), newBundleReader(cmd, args[0]), baler.NewDirFS(args[1]), config)
+				if err != nil && err.Type != baler.ErrorTypePartial {
+					handleError(cmd, err)
+				}
+				printPlan(cmd, plan)
+				if err != nil {
+					handleError(cmd, err)
+				}
+				if plan.Count(baler.PlanConflict) > 0 && !ignoreErrors {
+					os.Exit(1)
+				}
+				return
+			}
+			progress := newProgressBar(cmd, !config.Verbose && !unconvertNoProgress)
+			progress.observe(config)
+			err := baler.UnConvert(cmd.Context(), newBundleReader(cmd, args[0]), baler.NewDirFS(args[1]), config)
+			progress.clear()
+			if balerErr := writeReport(unconvertReport, config.Report); balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			if err != nil && err.Type != baler.ErrorTypePartial {
+				handleError(cmd, err)
 			}
-			err := baler.UnConvert(args[0], args[1], config)
 			if err != nil {
+				cmd.Println("Un-conversion completed with errors!")
 				handleError(cmd, err)
 			}
 			cmd.Println("Un-conversion successful!")
@@ -136,7 +357,15 @@ $ baler unconvert output_directory/ new_code_directory/
 	}
 	unconvertCmd.Flags().Uint64VarP(&unconvertMaxInputFileSize, "max-input-file-size", "i", 5*1024*1024, "Set maximum size (in bytes) of the input file(s).")
 	unconvertCmd.Flags().Uint64VarP(&unconvertMaxBufferSize, "max-buffer-size", "b", 0, "Set maximum size (in bytes) of buffer for copy operation.")
-	unconvertCmd.Flags().BoolVarP(&unconvertVerbose, "verbose", "v", false, "Run baler in verbose mode.")
+	unconvertCmd.Flags().BoolVarP(&unconvertVerbose, "verbose", "v", false, "Run baler in verbose mode, same as '--log-level info'.")
+	unconvertCmd.Flags().StringVar(&unconvertLogFormat, "log-format", logFormatText, "Format of the messages written to stderr. One of 'text', 'json'.")
+	unconvertCmd.Flags().StringVar(&unconvertLogLevel, "log-level", "warn", "Minimum level of the messages written to stderr. One of 'debug', 'info', 'warn', 'error'.")
+	unconvertCmd.Flags().BoolVar(&skipUnsafePaths, "skip-unsafe-paths", false, "Skip files with absolute paths, '..' or links outside the destination with a warning, instead of failing.")
+	unconvertCmd.Flags().StringVar(&backupDir, "backup-dir", "", "Keep a copy of the files overwritten by unconvert in this directory.")
+	unconvertCmd.Flags().BoolVar(&ignoreErrors, "ignore-errors", false, "Skip output files which can't be parsed and files which can't be written, and list them once done, instead of failing.")
+	unconvertCmd.Flags().StringVar(&unconvertReport, "report", "", "Write a JSON report of the created, overwritten and skipped files and timings to this path.")
+	unconvertCmd.Flags().BoolVar(&unconvertNoProgress, "no-progress", false, "Don't show a progress bar when stderr is a terminal.")
+	unconvertCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the files which would be created, overwritten or left untouched, without writing anything.")
 	unconvertCmd.Flags().StringVarP(
 		&unconvertFileDelimiter,
 		"delimiter",
@@ -144,8 +373,11 @@ $ baler unconvert output_directory/ new_code_directory/
 		"// filename: ",
 		`Text that separates 2 files in the generated file.
 Note that this delimiter is ALWAYS.
-	- prefixed by a new line ("\n")
-	- suffixed by the next file name and a new line ("\n")`,
+	- at the beginning of a line
+	- suffixed by the next file name and a new line ("\n")
+Every file is terminated by a new line ("\n"), which is dropped by 'unconvert'.
+'auto' detects delimiters picked by 'baler convert --delimiter auto'.`,
 	)
-	BalerCommand.AddCommand(versionCmd, convertCmd, unconvertCmd)
+	unconvertCmd.Flags().StringVarP(&unconvertFormat, "format", "f", string(baler.FormatAuto), "Format of the files generated by 'baler convert'. One of 'auto', 'text', 'markdown', 'xml', 'jsonl'.")
+	BalerCommand.AddCommand(versionCmd, convertCmd, unconvertCmd, newVerifyCommand(), newDiffCommand())
 }
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/plant99/baler/pkg/baler"
+	"github.com/spf13/cobra"
+)
+
+const (
+	progressBarWidth = 30
+	// the bar is redrawn at most this often, except for the last file
+	progressInterval = 100 * time.Millisecond
+)
+
+// progressBar draws the progress of convert and unconvert on the last
+// line of a terminal, e.g/
+//
+//	[##########--------------------]  12/36 files, 1.2 MiB, output_0.txt
+type progressBar struct {
+	writer  io.Writer
+	drawn   time.Time
+	visible bool
+}
+
+// newProgressBar returns a progress bar for stderr, or nil when stderr
+// isn't a terminal, or the bar is disabled, e.g/ by --verbose logs
+func newProgressBar(cmd *cobra.Command, enabled bool) *progressBar {
+	if !enabled {
+		return nil
+	}
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &progressBar{writer: cmd.ErrOrStderr()}
+}
+
+// observe sets the bar as the progress observer of config, and clears
+// it before the messages of its logger
+func (b *progressBar) observe(config *baler.BalerConfig) {
+	if b == nil {
+		return
+	}
+	config.Progress = b
+	if logger, ok := config.Logger.(*cliLogger); ok {
+		logger.progress = b
+	}
+}
+
+func (b *progressBar) Progress(progress baler.Progress) {
+	done := progress.FilesSeen == progress.FilesTotal
+	if !done && time.Since(b.drawn) < progressInterval {
+		return
+	}
+	b.drawn = time.Now()
+	filled := progressBarWidth
+	if progress.FilesTotal > 0 {
+		filled = progressBarWidth * progress.FilesSeen / progress.FilesTotal
+	}
+	line := fmt.Sprintf(
+		"[%s%s] %*d/%d files, %s",
+		strings.Repeat("#", filled),
+		strings.Repeat("-", progressBarWidth-filled),
+		len(fmt.Sprint(progress.FilesTotal)),
+		progress.FilesSeen,
+		progress.FilesTotal,
+		baler.FormatSize(uint64(progress.BytesWritten)),
+	)
+	if progress.FilesSkipped > 0 {
+		line += fmt.Sprintf(", %d skipped", progress.FilesSkipped)
+	}
+	if progress.OutputFile != "" {
+		line += ", " + progress.OutputFile
+	}
+	// \033[K clears the rest of the previous line
+	fmt.Fprintf(b.writer, "\r%s\033[K", line)
+	b.visible = true
+}
+
+// clear removes the bar, before messages are printed
+func (b *progressBar) clear() {
+	if b == nil || !b.visible {
+		return
+	}
+	fmt.Fprint(b.writer, "\r\033[K")
+	b.visible = false
+}
@@ -1,35 +1,121 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
 
-	"github.com/plant99/baler/internal/baler"
+	"github.com/plant99/baler/pkg/baler"
 	"github.com/spf13/cobra"
 )
 
-type cobraLogger struct {
-	cmd     *cobra.Command
-	verbose bool
+// newTokenizer returns the tokenizer named by --tokenizer. A vocabulary
+// file replaces the embedded one of the 'bpe' tokenizer.
+func newTokenizer(name string, vocabPath string) (baler.Tokenizer, error) {
+	if vocabPath == "" {
+		tokenizer, balerErr := baler.NewTokenizer(name)
+		if balerErr != nil {
+			return nil, balerErr
+		}
+		return tokenizer, nil
+	}
+	if name != baler.TokenizerBPE {
+		return nil, baler.NewConfigError("--tokenizer-vocab can only be used with the 'bpe' tokenizer", nil)
+	}
+	file, err := os.Open(vocabPath)
+	if err != nil {
+		return nil, baler.NewIOError(fmt.Sprintf("unable to open tokenizer vocabulary: %s", vocabPath), err)
+	}
+	defer file.Close()
+	tokenizer, err := baler.NewBPETokenizer(vocabPath, file)
+	if err != nil {
+		return nil, baler.NewConfigError(fmt.Sprintf("invalid tokenizer vocabulary: %s", vocabPath), err)
+	}
+	return tokenizer, nil
+}
+
+// newBundleReader returns the reader of the output files in source, or
+// of the standard input for '-'
+func newBundleReader(cmd *cobra.Command, source string) baler.BundleReader {
+	if source == "-" {
+		return baler.NewStreamBundleReader(cmd.InOrStdin())
+	}
+	return baler.NewDirBundleReader(source)
 }
 
-func newCobraLogger(cmd *cobra.Command, verbose bool) *cobraLogger {
-	return &cobraLogger{
-		cmd: cmd,
-		// TODO: remove
-		verbose: verbose,
+// newReport returns the report filled for --report, or nil without it
+func newReport(reportPath string) *baler.Report {
+	if reportPath == "" {
+		return nil
 	}
+	return &baler.Report{}
 }
 
-func (l *cobraLogger) Info(msg string) {
-	l.cmd.Printf("info: %s\n", msg)
+// writeReport writes the JSON report of --report, including when the
+// command failed
+func writeReport(reportPath string, report *baler.Report) *baler.BalerError {
+	if report == nil {
+		return nil
+	}
+	data, balerErr := report.JSON()
+	if balerErr != nil {
+		return balerErr
+	}
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		return baler.NewIOError(fmt.Sprintf("unable to write report: %s", reportPath), err)
+	}
+	return nil
 }
 
-func (l *cobraLogger) Warn(msg string) {
-	l.cmd.Printf("warn: %s\n", msg)
+// printPlan lists what 'unconvert' would do with every file, on stdout
+func printPlan(cmd *cobra.Command, plan *baler.UnconvertPlan) {
+	out := cmd.OutOrStdout()
+	for _, planned := range plan.Files {
+		switch planned.Action {
+		case baler.PlanCreate:
+			fmt.Fprintf(out, "create     %s (%d bytes)\n", planned.Path, planned.Size)
+		case baler.PlanOverwrite:
+			fmt.Fprintf(
+				out,
+				"overwrite  %s (%d -> %d bytes, %+d)\n",
+				planned.Path, planned.PreviousSize, planned.Size, planned.Size-planned.PreviousSize,
+			)
+		case baler.PlanUnchanged:
+			fmt.Fprintf(out, "unchanged  %s\n", planned.Path)
+		case baler.PlanConflict:
+			fmt.Fprintf(out, "conflict   %s: %s\n", planned.Path, planned.Reason)
+		case baler.PlanSkip:
+			fmt.Fprintf(out, "skip       %q: %s\n", planned.Path, planned.Reason)
+		}
+	}
+	fmt.Fprintf(
+		out,
+		"%d to create, %d to overwrite, %d unchanged, %d conflicts, %d skipped\n",
+		plan.Count(baler.PlanCreate),
+		plan.Count(baler.PlanOverwrite),
+		plan.Count(baler.PlanUnchanged),
+		plan.Count(baler.PlanConflict),
+		plan.Count(baler.PlanSkip),
+	)
 }
 
-func (l *cobraLogger) Error(msg string) {
-	l.cmd.PrintErrf("error: %s\n", msg)
+// printErrorSummary lists the files skipped with --ignore-errors
+func printErrorSummary(cmd *cobra.Command, balerErr *baler.BalerError) {
+	cmd.PrintErrf("%s:\n", strings.ToUpper(balerErr.Message[:1])+balerErr.Message[1:])
+	var multiErr *baler.MultiError
+	if !errors.As(balerErr, &multiErr) {
+		return
+	}
+	writer := tabwriter.NewWriter(cmd.ErrOrStderr(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "PATH\tERROR")
+	for _, fileError := range multiErr.Errors {
+		// one line per file
+		message := strings.ReplaceAll(fileError.Err.Error(), "\n", ": ")
+		fmt.Fprintf(writer, "%s\t%s\n", fileError.Path, message)
+	}
+	writer.Flush()
 }
 
 // TODO: the following function should use cobraLogger
@@ -53,6 +139,12 @@ func handleError(cmd *cobra.Command, err error) {
 		case baler.ErrorTypeInternal:
 			cmd.PrintErrf("Internal error: %v\n", balerErr)
 			os.Exit(1)
+		case baler.ErrorTypePartial:
+			printErrorSummary(cmd, balerErr)
+			os.Exit(2)
+		case baler.ErrorTypeCanceled:
+			cmd.PrintErrln("Interrupted.")
+			os.Exit(130)
 		}
 	}
 
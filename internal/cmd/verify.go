@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/plant99/baler/pkg/baler"
+	"github.com/spf13/cobra"
+)
+
+// shortChecksum shortens a SHA-256 for display
+func shortChecksum(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+func newVerifyCommand() *cobra.Command {
+	var maxInputFileSize, maxInputFileLines, maxOutputFileSize, maxBufferSize uint64
+	var exclusionPatterns, inclusionPatterns []string
+	var fileDelimiter, format string
+	var noIgnoreFiles, verbose, skipUnsafePaths bool
+	var verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Compare converted files with a source directory.",
+		Long: `Compare the output files of 'baler convert' with a source directory, e.g/ after editing them.
+
+Arguments: <converted-files-directory> <source-files-directory>
+
+Every file is reported as
+	A  added: in the converted files, but not in the source directory
+	D  removed: in the source directory, but not in the converted files
+	M  modified: with the SHA-256 of both versions
+Unchanged files are only reported in verbose mode.
+
+Files of the source directory are selected like 'baler convert' does. When the converted
+files directory has a baler.manifest.json, the exclusions, ignore files and limits recorded
+in it are used instead of the options.
+
+Exits with 1 when any file is added, removed or modified.
+
+e.g/
+
+$ baler verify output_directory/ code_directory/
+		`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ignoreFileNames := []string{".gitignore", ".balerignore"}
+			if noIgnoreFiles {
+				ignoreFileNames = []string{}
+			}
+			config := &baler.BalerConfig{
+				MaxInputFileLines: maxInputFileLines,
+				MaxInputFileSize:  maxInputFileSize,
+				MaxOutputFileSize: maxOutputFileSize,
+				MaxBufferSize:     maxBufferSize,
+				ExclusionPatterns: &exclusionPatterns,
+				IncludePatterns:   &inclusionPatterns,
+				IgnoreFileNames:   &ignoreFileNames,
+				Operation:         baler.OperationVerify,
+				FileDelimiter:     fileDelimiter,
+				Logger:            newTextLogger(cmd, verbose),
+				Verbose:           verbose,
+				SkipUnsafePaths:   skipUnsafePaths,
+			}
+			outputFormat, balerErr := baler.ParseOutputFormat(format)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			config.Format = outputFormat
+			report, balerErr := baler.Verify(cmd.Context(), baler.NewDirBundleReader(args[0]), baler.NewDirFS(args[1]), config)
+			if balerErr != nil {
+				handleError(cmd, balerErr)
+			}
+			out := cmd.OutOrStdout()
+			for _, result := range report.Results {
+				switch result.Status {
+				case baler.VerifyAdded:
+					fmt.Fprintf(out, "A  %s\n", result.Path)
+				case baler.VerifyRemoved:
+					fmt.Fprintf(out, "D  %s\n", result.Path)
+				case baler.VerifyModified:
+					fmt.Fprintf(
+						out,
+						"M  %s (converted %s, source %s)\n",
+						result.Path,
+						shortChecksum(result.BundleSHA256),
+						shortChecksum(result.SourceSHA256),
+					)
+				case baler.VerifyUnchanged:
+					if verbose {
+						fmt.Fprintf(out, "   %s\n", result.Path)
+					}
+				}
+			}
+			fmt.Fprintf(
+				out,
+				"%d added, %d removed, %d modified, %d unchanged\n",
+				report.Count(baler.VerifyAdded),
+				report.Count(baler.VerifyRemoved),
+				report.Count(baler.VerifyModified),
+				report.Count(baler.VerifyUnchanged),
+			)
+			if report.HasDrift() {
+				os.Exit(1)
+			}
+		},
+	}
+	verifyCmd.Flags().Uint64VarP(&maxInputFileSize, "max-input-file-size", "i", 1*1024*1024, "Set maximum file size (in bytes) to be considered while converting.")
+	verifyCmd.Flags().Uint64VarP(&maxInputFileLines, "max-input-file-lines", "l", 10000, "Set maximum lines a file can have to be considered while converting.")
+	verifyCmd.Flags().Uint64VarP(&maxOutputFileSize, "max-output-file-size", "o", 5*1024*1024, "Set maximum size (in bytes) of the converted files.")
+	verifyCmd.Flags().Uint64VarP(&maxBufferSize, "max-buffer-size", "b", 0, "Set maximum size (in bytes) of buffer for read operations.")
+	verifyCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Run baler in verbose mode.")
+	verifyCmd.Flags().StringVarP(&fileDelimiter, "delimiter", "d", "// filename: ", "Text that separates 2 files in the converted files, 'auto' detects it.")
+	verifyCmd.Flags().StringVarP(&format, "format", "f", string(baler.FormatAuto), "Format of the converted files. One of 'auto', 'text', 'markdown', 'xml', 'jsonl'.")
+	verifyCmd.Flags().StringSliceVarP(&exclusionPatterns, "exclude", "e", []string{}, "A list of exclusion patterns for baler. e.g '-e \"node_modules*\" -e \"poetry.*\" -e \"package.*\"'")
+	verifyCmd.Flags().StringSliceVarP(&inclusionPatterns, "include", "I", []string{}, "A list of inclusion patterns for baler. Only matching files are compared.")
+	verifyCmd.Flags().BoolVar(&noIgnoreFiles, "no-ignore-files", false, "Don't apply rules from .gitignore and .balerignore files.")
+	verifyCmd.Flags().BoolVar(&skipUnsafePaths, "skip-unsafe-paths", false, "Skip files with absolute paths, '..' or links outside the directory with a warning, instead of failing.")
+	return verifyCmd
+}
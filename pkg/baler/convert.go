@@ -0,0 +1,846 @@
+package baler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type ValidationResult struct {
+	IsValidUTF8  bool
+	IsValidLines bool
+	IsValidSize  bool
+	// always true when no tokenizer is configured
+	IsValidTokens bool
+	// not valid UTF-8 and contains a NUL byte, e.g/ an image
+	IsBinary bool
+	// artifacts
+	Size  uint64
+	Lines uint64
+	// 0 when no tokenizer is configured
+	Tokens uint64
+}
+
+// SkipReason is why a file of the input isn't converted, logged as the
+// "reason" attribute of skipped files
+type SkipReason string
+
+const (
+	// matches an exclusion pattern
+	SkipExcluded SkipReason = "excluded"
+	// matches a rule of an ignore file, e.g/ .gitignore
+	SkipIgnored SkipReason = "ignored"
+	// doesn't match any include pattern
+	SkipNotIncluded   SkipReason = "not_included"
+	SkipTooLarge      SkipReason = "too_large"
+	SkipTooManyLines  SkipReason = "too_many_lines"
+	SkipNotUTF8       SkipReason = "not_utf8"
+	SkipBinary        SkipReason = "binary"
+	SkipTooManyTokens SkipReason = "too_many_tokens"
+	// can't be read, with IgnoreErrors
+	SkipError SkipReason = "error"
+	// while unconverting, identical to the destination file
+	SkipUnchanged SkipReason = "unchanged"
+	// while unconverting, with SkipUnsafePaths
+	SkipUnsafePath SkipReason = "unsafe_path"
+)
+
+// Reason returns why the file isn't converted, or "" if it is
+func (v *ValidationResult) Reason() SkipReason {
+	switch {
+	case !v.IsValidSize:
+		return SkipTooLarge
+	case !v.IsValidUTF8 && v.IsBinary:
+		return SkipBinary
+	case !v.IsValidUTF8:
+		return SkipNotUTF8
+	case !v.IsValidLines:
+		return SkipTooManyLines
+	case !v.IsValidTokens:
+		return SkipTooManyTokens
+	}
+	return ""
+}
+
+func customScanner(reader io.Reader, config *BalerConfig) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	buf := make([]byte, 0, 64*1024)
+	var maxBufSize uint64
+	if config.MaxBufferSize > 0 {
+		maxBufSize = config.MaxBufferSize
+	} else {
+		maxBufSize = config.MaxInputFileSize
+	}
+	// if maxBufSize < 64 * 1024, it won't affect the buffer
+	scanner.Buffer(buf, int(maxBufSize))
+	return scanner
+}
+
+// isValid reports whether a file passes every check, and is converted
+func (v *ValidationResult) isValid() bool {
+	return v.IsValidUTF8 && v.IsValidLines && v.IsValidSize && v.IsValidTokens
+}
+
+// oversizedFile is the validation result of a file larger than
+// MaxInputFileSize, which isn't read
+func oversizedFile(fileInfo fs.FileInfo) *ValidationResult {
+	return &ValidationResult{
+		IsValidUTF8:   true,
+		IsValidLines:  true,
+		IsValidSize:   false,
+		IsValidTokens: true,
+		Size:          uint64(fileInfo.Size()),
+	}
+}
+
+func validateFile(fsys fs.FS, fileName string, config *BalerConfig) (*ValidationResult, *BalerError) {
+	// checks without opening the file
+	fileInfo, err := fs.Stat(fsys, fileName)
+	if err != nil {
+		return nil, NewIOError(fmt.Sprintf("failed to get file info for: %s", displayPath(fsys, fileName)), err)
+	}
+	if fileInfo.Size() > int64(config.MaxInputFileSize) {
+		return oversizedFile(fileInfo), nil
+	}
+	// checks including reads of the file
+	content, err := fs.ReadFile(fsys, fileName)
+	if err != nil {
+		return nil, NewIOError(fmt.Sprintf("unable to read: %s", displayPath(fsys, fileName)), err)
+	}
+	return validateContent(displayPath(fsys, fileName), content, config)
+}
+
+// bytes of a file looked at for NUL bytes, to tell binary files apart
+const binaryCheckSize = 8000
+
+// validateContent validates the content of a file which isn't larger
+// than MaxInputFileSize, fileName is only used in error messages
+func validateContent(fileName string, content []byte, config *BalerConfig) (*ValidationResult, *BalerError) {
+	isValidUTF8 := true
+	isValidLines := true
+	scanner := customScanner(bytes.NewReader(content), config)
+	lineCount := uint32(0)
+
+	for scanner.Scan() {
+		lineCount++
+		if lineCount <= 10 && !utf8.Valid(scanner.Bytes()) {
+			isValidUTF8 = false
+		}
+	}
+	// JSON strings can't hold invalid UTF-8, which would be replaced by
+	// U+FFFD, so jsonl files are checked entirely
+	if config.Format == FormatJSONL && isValidUTF8 && !utf8.Valid(content) {
+		isValidUTF8 = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NewIOError(
+			fmt.Sprintf(
+				"error scanning file: %s.\nPlease try setting an increased '--max-input-file-size' or '--max-buffer-size'",
+				fileName,
+			),
+			err,
+		)
+	}
+	if lineCount > uint32(config.MaxInputFileLines) {
+		isValidLines = false
+	}
+	// token count is only required for files which will be converted
+	isValidTokens := true
+	tokenCount := uint64(0)
+	if config.Tokenizer != nil && isValidUTF8 && isValidLines {
+		tokenCount = config.Tokenizer.CountTokens(content)
+		if config.MaxInputFileTokens > 0 && tokenCount > config.MaxInputFileTokens {
+			isValidTokens = false
+		}
+	}
+	// like git, only the beginning of the file is looked at
+	isBinary := !isValidUTF8 && bytes.IndexByte(content[:min(len(content), binaryCheckSize)], 0) >= 0
+	return &ValidationResult{
+		IsValidUTF8:   isValidUTF8,
+		IsBinary:      isBinary,
+		IsValidLines:  isValidLines,
+		IsValidSize:   true,
+		IsValidTokens: isValidTokens,
+		Size:          uint64(len(content)),
+		Lines:         uint64(lineCount),
+		Tokens:        tokenCount,
+	}, nil
+}
+
+// matchingPattern returns the first pattern in patternList matching relativePath.
+// For directories, patterns matching everything inside the directory
+// (e.g/ "node_modules/*" or "**/vendor/**") also match the directory itself
+// so that it isn't walked.
+func matchingPattern(relativePath string, isDir bool, patternList *[]string) (string, bool, *BalerError) {
+	if patternList == nil {
+		return "", false, nil
+	}
+	relativePath = filepath.ToSlash(relativePath)
+	for _, pattern := range *patternList {
+		matches, err := matchGlob(pattern, relativePath)
+		if err == nil && !matches && isDir {
+			matches, err = matchGlobDirectory(pattern, relativePath)
+		}
+		if err != nil {
+			return "", false, NewValidationError(
+				fmt.Sprintf(
+					"error matching path with pattern:  %s %s",
+					pattern,
+					relativePath,
+				),
+				err,
+			)
+		}
+		if matches {
+			return pattern, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func shouldIgnore(relativePath string, isDir bool, patternList *[]string) (bool, *BalerError) {
+	_, matches, balerErr := matchingPattern(relativePath, isDir, patternList)
+	return matches, balerErr
+}
+
+// shouldInclude reports whether a file is allowed by the include patterns.
+// All files are included when there are no include patterns.
+func shouldInclude(relativePath string, patternList *[]string) (bool, *BalerError) {
+	if patternList == nil || len(*patternList) == 0 {
+		return true, nil
+	}
+	_, matches, balerErr := matchingPattern(relativePath, false, patternList)
+	return matches, balerErr
+}
+
+// copyContent writes a file read by loadSourceFile, formatted by the
+// formatter of destFile, and returns its manifest entry without the
+// location in the output file
+func copyContent(entry *bundleEntry, formatted []byte, srcInfo fs.FileInfo, destFile *outputFile) (*ManifestFile, *BalerError) {
+	content := entry.Content
+	if balerErr := destFile.write(formatted); balerErr != nil {
+		return nil, balerErr
+	}
+
+	return &ManifestFile{
+		Path:    entry.Path,
+		Length:  int64(len(formatted)),
+		Lines:   bytes.Count(formatted, []byte("\n")),
+		Size:    int64(len(content)),
+		Mode:    fmt.Sprintf("%04o", entry.Mode),
+		ModTime: srcInfo.ModTime().UTC(),
+		SHA256:  checksum(content),
+	}, nil
+}
+
+// processingDir is a directory pending to be walked, along with
+// the ignore rules inherited from its parents
+type processingDir struct {
+	// slash separated path in the input file system, "." for its root
+	relPath string
+	ignore  *ignoreMatcher
+}
+
+// outputFile is an output file being written, which keeps track of its
+// size since sinks can't be inspected
+type outputFile struct {
+	name   string
+	writer io.WriteCloser
+	size   int64
+}
+
+func (f *outputFile) write(data []byte) *BalerError {
+	n, err := f.writer.Write(data)
+	f.size += int64(n)
+	if err != nil {
+		return NewIOError(fmt.Sprintf("unable to write to file: %s", f.name), err)
+	}
+	return nil
+}
+
+// abort closes the output file without the epilogue, when convert fails
+func (f *outputFile) abort() {
+	f.writer.Close()
+}
+
+// openOutputFile creates an output file, and writes the prologue of the format
+func openOutputFile(sink BundleWriter, outputFileName string, formatter bundleFormatter) (*outputFile, *BalerError) {
+	writer, err := sink.Create(outputFileName)
+	if err != nil {
+		return nil, NewIOError(
+			fmt.Sprintf("unable to open file: %s", outputFileName),
+			err,
+		)
+	}
+	destination := &outputFile{name: outputFileName, writer: writer}
+	if balerErr := destination.write(formatter.prologue()); balerErr != nil {
+		destination.abort()
+		return nil, balerErr
+	}
+	return destination, nil
+}
+
+// closeOutputFile writes the epilogue of the format and closes the output file
+func closeOutputFile(destination *outputFile, formatter bundleFormatter) *BalerError {
+	if balerErr := destination.write(formatter.epilogue()); balerErr != nil {
+		destination.abort()
+		return balerErr
+	}
+	if err := destination.writer.Close(); err != nil {
+		return NewIOError(fmt.Sprintf("unable to close file: %s", destination.name), err)
+	}
+	return nil
+}
+
+// countPrologue returns the tokens and lines of the prologue,
+// with which every output file begins
+func countPrologue(formatter bundleFormatter, config *BalerConfig) (uint64, int) {
+	prologue := formatter.prologue()
+	tokens := uint64(0)
+	if config.Tokenizer != nil {
+		tokens = config.Tokenizer.CountTokens(prologue)
+	}
+	return tokens, bytes.Count(prologue, []byte("\n"))
+}
+
+// sourceEntry is a file or directory of the input selected by the walk
+type sourceEntry struct {
+	// slash separated path in the input file system
+	relPath string
+	isDir   bool
+}
+
+// collectSourceEntries walks fsys and returns the entries which aren't
+// excluded, ignored, or missing an include pattern
+func collectSourceEntries(ctx context.Context, fsys fs.FS, config *BalerConfig, errs *errorCollector) ([]sourceEntry, *BalerError) {
+	processingStack := []processingDir{{relPath: ".", ignore: &ignoreMatcher{}}}
+	sourceEntries := []sourceEntry{}
+
+	for len(processingStack) > 0 {
+		if balerErr := checkCanceled(ctx); balerErr != nil {
+			return nil, balerErr
+		}
+		current := processingStack[len(processingStack)-1]
+		processingStack = processingStack[:len(processingStack)-1]
+		currentRelDir := current.relPath
+
+		entries, err := fs.ReadDir(fsys, currentRelDir)
+		if err != nil {
+			balerErr := NewIOError(fmt.Sprintf("unable to read directory: %s", displayPath(fsys, currentRelDir)), err)
+			if balerErr = errs.handle(currentRelDir, balerErr); balerErr != nil {
+				return nil, balerErr
+			}
+			continue
+		}
+		if currentRelDir == "." {
+			currentRelDir = ""
+		}
+		// rules from ignore files in this directory apply to it and its children
+		ignoreRules, balerErr := loadIgnoreFiles(fsys, currentRelDir, config.IgnoreFileNames)
+		if balerErr != nil {
+			// without its ignore rules, the directory is skipped entirely
+			if balerErr = errs.handle(current.relPath, balerErr); balerErr != nil {
+				return nil, balerErr
+			}
+			continue
+		}
+		currentIgnore := current.ignore.withRules(ignoreRules)
+		// iterate through entries
+		for _, entry := range entries {
+			relPath := path.Join(currentRelDir, entry.Name())
+			if config.outputPaths[relPath] {
+				continue
+			}
+
+			// ignore logic, exclusions take precedence over inclusions
+			if pattern, ignore, balerErr := matchingPattern(relPath, entry.IsDir(), config.ExclusionPatterns); balerErr != nil {
+				return nil, balerErr
+			} else if ignore {
+				config.Report.skip(relPath, SkipExcluded, 0, pattern)
+				if config.Verbose {
+					config.Logger.Info("Skipping file", "path", relPath, "reason", SkipExcluded, "pattern", pattern)
+				}
+				continue
+			}
+			// like git, which never tracks its own directory
+			if entry.IsDir() && entry.Name() == ".git" && usesGitIgnore(config.IgnoreFileNames) {
+				config.Report.skip(relPath, SkipIgnored, 0, ".git")
+				if config.Verbose {
+					config.Logger.Info("Skipping file", "path", relPath, "reason", SkipIgnored)
+				}
+				continue
+			}
+			if ignore, rule := currentIgnore.match(relPath, entry.IsDir()); ignore {
+				config.Report.skip(relPath, SkipIgnored, 0, rule.Source+": "+rule.Pattern)
+				if config.Verbose {
+					config.Logger.Info(
+						"Skipping file",
+						"path", relPath, "reason", SkipIgnored, "ignore_file", rule.Source, "pattern", rule.Pattern,
+					)
+				}
+				continue
+			}
+
+			// for each directory, append to processingStack
+			if entry.IsDir() {
+				processingStack = append(processingStack, processingDir{relPath: relPath, ignore: currentIgnore})
+			} else if include, balerErr := shouldInclude(relPath, config.IncludePatterns); balerErr != nil {
+				return nil, balerErr
+			} else if !include {
+				config.Report.skip(relPath, SkipNotIncluded, 0, "")
+				if config.Verbose {
+					config.Logger.Info("Skipping file", "path", relPath, "reason", SkipNotIncluded)
+				}
+				continue
+			}
+			sourceEntries = append(sourceEntries, sourceEntry{relPath: relPath, isDir: entry.IsDir()})
+		}
+	}
+	return sourceEntries, nil
+}
+
+// validateSourceEntries loads every file of sourceEntries, for the directory
+// tree and the automatic delimiter which depend on all of them before the
+// first one is written. The content of valid files is kept until they're
+// written. Results are nil for directories, and for files which failed with
+// IgnoreErrors.
+func validateSourceEntries(ctx context.Context, fsys fs.FS, sourceEntries []sourceEntry, config *BalerConfig, errs *errorCollector) ([]*sourceFile, *BalerError) {
+	files := make([]*sourceFile, len(sourceEntries))
+	balerErr := scanSourceFiles(
+		ctx,
+		sourceEntries,
+		config,
+		func(_ int, source sourceEntry) *sourceFile {
+			return loadSourceFile(fsys, source, config)
+		},
+		func(index int, file *sourceFile) *BalerError {
+			if file != nil && file.err != nil {
+				return errs.handle(sourceEntries[index].relPath, file.err)
+			}
+			files[index] = file
+			return nil
+		},
+	)
+	return files, balerErr
+}
+
+// logSkippedFile logs why a file which failed validation isn't converted
+func logSkippedFile(relPath string, validationResult *ValidationResult, config *BalerConfig) {
+	if !config.Verbose {
+		return
+	}
+	args := []any{"path", relPath, "reason", validationResult.Reason(), "size", validationResult.Size}
+	// lines aren't counted past the size limit, nor tokens of files
+	// skipped for their lines or encoding
+	if validationResult.IsValidSize {
+		args = append(args, "lines", validationResult.Lines)
+	}
+	if config.Tokenizer != nil && validationResult.Reason() == SkipTooManyTokens {
+		args = append(args, "tokens", validationResult.Tokens)
+	}
+	config.Logger.Info("Skipping file", args...)
+}
+
+// convertDirectoryAndSaveToFile writes the output files of fsys into sink,
+// and the manifest unless sink is a stream
+func convertDirectoryAndSaveToFile(ctx context.Context, fsys fs.FS, sink BundleWriter, config *BalerConfig, errs *errorCollector) (*[]string, *BalerError) {
+	var fileCounter = 0
+	filesProcessed := &[]string{}
+
+	sourceEntries, balerErr := collectSourceEntries(ctx, fsys, config, errs)
+	if balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	if balerErr := orderSourceEntries(fsys, sourceEntries, config); balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	config.Report.scanned()
+	filesTotal := 0
+	for _, source := range sourceEntries {
+		if !source.isDir {
+			filesTotal++
+		}
+	}
+	progress := newProgressTracker(config, OperationConvert, filesTotal)
+	formatConfig := config
+	delimiter := config.FileDelimiter
+	autoDelimiter := config.FileDelimiter == DelimiterAuto && (config.Format == "" || config.Format == FormatText)
+	// files read by a first pass, only when the output depends on all of them
+	var validatedFiles []*sourceFile
+	if config.Tree || autoDelimiter {
+		validatedFiles, balerErr = validateSourceEntries(ctx, fsys, sourceEntries, config, errs)
+		if balerErr != nil {
+			return &[]string{}, balerErr
+		}
+		config.Report.validated()
+	}
+	if autoDelimiter {
+		delimiter = chooseDelimiter(validatedFiles)
+		if config.Verbose {
+			config.Logger.Info("Using delimiter", "delimiter", delimiter)
+		}
+		formatConfig = &BalerConfig{}
+		*formatConfig = *config
+		formatConfig.FileDelimiter = delimiter
+	}
+	formatter, balerErr := newBundleFormatter(formatConfig)
+	if balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	manifest := newManifest(config, delimiter)
+	// reference to file in destinationPath
+	outputFileName := fmt.Sprintf("output_%s.txt", strconv.Itoa(fileCounter))
+
+	destinationFile, balerErr := openOutputFile(sink, outputFileName, formatter)
+	if balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	manifest.addOutputFile(outputFileName)
+	// closes the current output file when convert fails
+	defer func() { destinationFile.abort() }()
+	// tokens in the current output file, only counted with a tokenizer
+	destinationTokens, destinationLines := countPrologue(formatter, config)
+	// an output file with only its prologue has no content, and every output
+	// file ends with the epilogue
+	prologueTokens, epilogueTokens := destinationTokens, uint64(0)
+	if config.Tokenizer != nil {
+		epilogueTokens = config.Tokenizer.CountTokens(formatter.epilogue())
+	}
+	if config.Tree {
+		validations := make([]*ValidationResult, len(validatedFiles))
+		for i, file := range validatedFiles {
+			if file != nil {
+				validations[i] = file.validation
+			}
+		}
+		tree := buildTree(rootName(fsys), sourceEntries, validations, errs).render()
+		header := formatter.formatTree(tree)
+		if balerErr := destinationFile.write(header); balerErr != nil {
+			return &[]string{}, balerErr
+		}
+		if config.Tokenizer != nil {
+			destinationTokens += config.Tokenizer.CountTokens(header)
+		}
+		destinationLines += bytes.Count(header, []byte("\n"))
+	}
+
+	// writes the files in the order of sourceEntries, as they're loaded
+	writeFile := func(index int, file *sourceFile) *BalerError {
+		source := sourceEntries[index]
+		relPath := source.relPath
+		if !source.isDir {
+			if file == nil {
+				// failed in the first pass, and already recorded
+				progress.skipped(relPath)
+				return nil
+			}
+			if file.err != nil {
+				if balerErr := errs.handle(relPath, file.err); balerErr != nil {
+					return balerErr
+				}
+				progress.skipped(relPath)
+				return nil
+			}
+			validationResult := file.validation
+			if !validationResult.isValid() {
+				logSkippedFile(relPath, validationResult, config)
+				config.Report.skip(relPath, validationResult.Reason(), validationResult.Size, "")
+				progress.skipped(relPath)
+				return nil
+			}
+			// check if the formatted entry + existing sink file + the epilogue
+			// exceeds size limit, if so, increment file name counter and set it
+			// as sink. An entry larger than the limit is written alone rather
+			// than rolling over an output file without content.
+			formatted := formatter.formatEntry(file.entry)
+			hasContent := destinationFile.size > int64(len(formatter.prologue()))
+			// tokens added by the format, e.g/ the delimiter and path
+			headerTokens := uint64(0)
+			if config.Tokenizer != nil {
+				headerTokens = config.Tokenizer.CountTokens(
+					formatter.formatEntry(&bundleEntry{Path: relPath}),
+				)
+			}
+			exceedsTokens := config.MaxOutputTokens > 0 && destinationTokens > prologueTokens &&
+				destinationTokens+headerTokens+validationResult.Tokens+epilogueTokens > config.MaxOutputTokens
+			exceedsSize := hasContent &&
+				destinationFile.size+int64(len(formatted)+len(formatter.epilogue())) > int64(config.MaxOutputFileSize)
+			// streams are never split
+			if !isStream(sink) && (exceedsSize || exceedsTokens) {
+				// close reference to old file
+				if balerErr := closeOutputFile(destinationFile, formatter); balerErr != nil {
+					return balerErr
+				}
+				config.Report.output(outputFileName, destinationFile.size)
+
+				// update reference to new file
+				fileCounter++
+				outputFileName = fmt.Sprintf("output_%s.txt", strconv.Itoa(fileCounter))
+				destinationFile, balerErr = openOutputFile(sink, outputFileName, formatter)
+				if balerErr != nil {
+					return balerErr
+				}
+				manifest.addOutputFile(outputFileName)
+				destinationTokens, destinationLines = countPrologue(formatter, config)
+			}
+			// perform copy
+			offset := destinationFile.size
+			manifestFile, balerErr := copyContent(file.entry, formatted, file.info, destinationFile)
+			if balerErr != nil {
+				return balerErr
+			}
+			manifestFile.OutputFile = outputFileName
+			manifestFile.Offset = offset
+			manifestFile.Line = destinationLines + 1
+			manifest.addFile(*manifestFile)
+			config.Report.include(ReportFile{
+				Path:       relPath,
+				Size:       manifestFile.Size,
+				Lines:      int(validationResult.Lines),
+				Tokens:     validationResult.Tokens,
+				OutputFile: outputFileName,
+			})
+			destinationTokens += headerTokens + validationResult.Tokens
+			destinationLines += manifestFile.Lines
+			progress.progress.OutputFile = outputFileName
+			progress.written(relPath, manifestFile.Size)
+		}
+		*filesProcessed = append(*filesProcessed, relPath)
+		if config.Verbose {
+			if source.isDir {
+				config.Logger.Info("Processed directory", "path", relPath)
+			} else {
+				config.Logger.Info(
+					"Processed file",
+					"path", relPath, "size", file.validation.Size, "lines", file.validation.Lines, "output_file", outputFileName,
+				)
+			}
+		}
+		return nil
+	}
+	load := func(index int, source sourceEntry) *sourceFile {
+		// files loaded by the first pass aren't read again, and are released
+		// once written
+		if validatedFiles != nil {
+			file := validatedFiles[index]
+			validatedFiles[index] = nil
+			return file
+		}
+		return loadSourceFile(fsys, source, config)
+	}
+	if balerErr := scanSourceFiles(ctx, sourceEntries, config, load, writeFile); balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	if balerErr := closeOutputFile(destinationFile, formatter); balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	config.Report.output(outputFileName, destinationFile.size)
+	if !isStream(sink) {
+		if balerErr := writeManifest(sink, manifest); balerErr != nil {
+			return &[]string{}, balerErr
+		}
+	}
+	config.Report.written()
+	return filesProcessed, nil
+}
+
+// isPlainFileName reports whether name is a file name without directories
+func isPlainFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
+
+// previousOutputFiles returns the output files listed by the manifest of a
+// previous run, and the manifest itself
+func previousOutputFiles(previous *Manifest) []string {
+	var previousFiles []string
+	if previous != nil {
+		for _, name := range previous.OutputFiles {
+			// the manifest could have been edited, only files next to it are removed
+			if isPlainFileName(name) {
+				previousFiles = append(previousFiles, name)
+			}
+		}
+		previousFiles = append(previousFiles, ManifestFileName)
+	}
+	return previousFiles
+}
+
+// moveOutputs moves the output files and manifest built in buildDir into
+// destinationDir. The output files of the previous manifest of
+// destinationDir are replaced, and restored if the new ones can't be moved
+// into place.
+func moveOutputs(buildDir string, destinationDir string, previous *Manifest, config *BalerConfig) *BalerError {
+	manifest, balerErr := ReadManifest(NewDirFS(buildDir))
+	if balerErr != nil {
+		return balerErr
+	}
+	previousFiles := previousOutputFiles(previous)
+	// the manifest is moved last, it marks complete output
+	newFiles := append(append([]string{}, manifest.OutputFiles...), ManifestFileName)
+	for _, name := range newFiles {
+		if _, err := os.Lstat(filepath.Join(destinationDir, name)); err == nil && !slices.Contains(previousFiles, name) {
+			return NewValidationError(
+				fmt.Sprintf("%s already exists in %s, and isn't listed in a manifest of baler", name, destinationDir),
+				nil,
+			)
+		}
+	}
+
+	// previous output files are kept in buildDir until the new ones are in place
+	previousDir := filepath.Join(buildDir, "previous")
+	if err := os.Mkdir(previousDir, 0755); err != nil {
+		return NewIOError(fmt.Sprintf("unable to create directory: %s", previousDir), err)
+	}
+	var movedAway, movedIn []string
+	restore := func() {
+		for i := len(movedIn) - 1; i >= 0; i-- {
+			os.Remove(filepath.Join(destinationDir, movedIn[i]))
+		}
+		for i := len(movedAway) - 1; i >= 0; i-- {
+			if err := os.Rename(filepath.Join(previousDir, movedAway[i]), filepath.Join(destinationDir, movedAway[i])); err != nil {
+				config.Logger.Error("Unable to restore previous output file", "output_file", movedAway[i], "error", err)
+			}
+		}
+	}
+	for _, name := range previousFiles {
+		err := os.Rename(filepath.Join(destinationDir, name), filepath.Join(previousDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			restore()
+			return NewIOError(fmt.Sprintf("unable to remove previous output file: %s", name), err)
+		}
+		movedAway = append(movedAway, name)
+		if config.Verbose {
+			config.Logger.Info("Removing previous output file", "output_file", name)
+		}
+	}
+	for _, name := range newFiles {
+		if err := os.Rename(filepath.Join(buildDir, name), filepath.Join(destinationDir, name)); err != nil {
+			restore()
+			return NewIOError(fmt.Sprintf("unable to move output file into place: %s", name), err)
+		}
+		movedIn = append(movedIn, name)
+	}
+	return nil
+}
+
+// Convert writes the files of fsys into output files created by sink, along
+// with a manifest unless sink is a stream. Files written before an error
+// are left in sink, see ConvertDir for output files which are only moved
+// into place once complete.
+func Convert(ctx context.Context, fsys fs.FS, sink BundleWriter, config *BalerConfig) (*[]string, *BalerError) {
+	config.Report.start(OperationConvert)
+	if balerErr := checkDirectory(fsys, "input directory"); balerErr != nil {
+		config.Report.finish(balerErr)
+		return &[]string{}, balerErr
+	}
+	errs := newErrorCollector(config)
+	processedPaths, balerErr := convertDirectoryAndSaveToFile(ctx, fsys, sink, config, errs)
+	if balerErr != nil {
+		config.Report.finish(balerErr)
+		return &[]string{}, balerErr
+	}
+	// files skipped with IgnoreErrors
+	balerErr = errs.result()
+	config.Report.finish(balerErr)
+	return processedPaths, balerErr
+}
+
+// ConvertDir converts the directory inputPath into output files in
+// outputPath. They're built next to it and moved into place once complete,
+// replacing the ones of a previous convert with config.Overwrite.
+func ConvertDir(ctx context.Context, inputPath string, outputPath string, config *BalerConfig) (*[]string, *BalerError) {
+	config.Report.start(OperationConvert)
+	processedPaths, balerErr := convertDir(ctx, inputPath, outputPath, config)
+	config.Report.finish(balerErr)
+	return processedPaths, balerErr
+}
+
+func convertDir(ctx context.Context, inputPath string, outputPath string, config *BalerConfig) (*[]string, *BalerError) {
+	// check if input, output paths exists
+	if _, err := os.Stat(inputPath); err != nil {
+		return &[]string{}, NewIOError(
+			fmt.Sprintf("unable to get information on %s. Are you sure this path exists? ", inputPath),
+			err,
+		)
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		return &[]string{}, NewIOError(
+			fmt.Sprintf("unable to get information on %s. Are you sure this path exists? ", outputPath),
+			err,
+		)
+	}
+	absInputPath, err := filepath.Abs(inputPath)
+	if err != nil {
+		return &[]string{}, NewIOError(
+			fmt.Sprintf("unable to get absolute path for %s", inputPath),
+			err,
+		)
+	}
+	// checked before converting, previous output is only replaced with Overwrite
+	previous, balerErr := ReadManifest(NewDirFS(outputPath))
+	if balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	if previous != nil && !config.Overwrite {
+		return &[]string{}, NewValidationError(
+			fmt.Sprintf("%s already contains the output of baler, use '--overwrite' to replace it", outputPath),
+			nil,
+		)
+	}
+	// output files are built inside outputPath, to be renamed into place on
+	// success, and removed along with the directory on failure
+	buildDir, err := os.MkdirTemp(outputPath, ".baler-convert-")
+	if err != nil {
+		return &[]string{}, NewIOError(fmt.Sprintf("unable to create a directory in %s", outputPath), err)
+	}
+	defer os.RemoveAll(buildDir)
+	convertConfig, balerErr := withOutputPaths(config, absInputPath, buildDir, previous)
+	if balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	processedPaths, balerErr := Convert(ctx, NewDirFS(absInputPath), NewDirBundleWriter(buildDir), convertConfig)
+	if balerErr != nil && balerErr.Type != ErrorTypePartial {
+		return &[]string{}, balerErr
+	}
+	if balerErr := moveOutputs(buildDir, outputPath, previous, config); balerErr != nil {
+		return &[]string{}, balerErr
+	}
+	// files skipped with IgnoreErrors
+	return processedPaths, balerErr
+}
+
+// withOutputPaths returns config, or a copy of it which doesn't convert
+// buildDir and the previous output files when they're inside inputPath,
+// e.g/ with 'baler convert ./ ./out'
+func withOutputPaths(config *BalerConfig, inputPath string, buildDir string, previous *Manifest) (*BalerConfig, *BalerError) {
+	absBuildDir, err := filepath.Abs(buildDir)
+	if err != nil {
+		return nil, NewIOError(fmt.Sprintf("unable to get absolute path for %s", buildDir), err)
+	}
+	relBuildDir, err := filepath.Rel(inputPath, absBuildDir)
+	if err != nil || !filepath.IsLocal(relBuildDir) {
+		return config, nil
+	}
+	relBuildDir = filepath.ToSlash(relBuildDir)
+	outputDir := path.Dir(relBuildDir)
+	convertConfig := &BalerConfig{}
+	*convertConfig = *config
+	convertConfig.outputPaths = map[string]bool{relBuildDir: true}
+	for _, name := range previousOutputFiles(previous) {
+		convertConfig.outputPaths[path.Join(outputDir, name)] = true
+	}
+	return convertConfig, nil
+}
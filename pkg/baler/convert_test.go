@@ -0,0 +1,833 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/quick"
+)
+
+// logRecord is a message of mockLogger with its attributes
+type logRecord struct {
+	msg   string
+	attrs map[string]any
+}
+
+func newLogRecord(msg string, args []any) logRecord {
+	record := logRecord{msg: msg, attrs: map[string]any{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		record.attrs[args[i].(string)] = args[i+1]
+	}
+	return record
+}
+
+type mockLogger struct {
+	infoMessages  []logRecord
+	warnMessages  []logRecord
+	errorMessages []logRecord
+}
+
+func (l *mockLogger) Info(msg string, args ...any) {
+	l.infoMessages = append(l.infoMessages, newLogRecord(msg, args))
+}
+
+func (l *mockLogger) Warn(msg string, args ...any) {
+	l.warnMessages = append(l.warnMessages, newLogRecord(msg, args))
+}
+
+func (l *mockLogger) Error(msg string, args ...any) {
+	l.errorMessages = append(l.errorMessages, newLogRecord(msg, args))
+}
+
+func TestValidateFile(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	tests := []struct {
+		name           string
+		content        string
+		maxSize        uint64
+		maxLines       uint64
+		format         OutputFormat
+		expectValid    bool
+		expectedResult *ValidationResult
+	}{
+		{
+			name:        "Valid small file",
+			content:     "test\nfile\ncontent",
+			maxSize:     1024,
+			maxLines:    10,
+			expectValid: true,
+			expectedResult: &ValidationResult{
+				IsValidUTF8:  true,
+				IsValidLines: true,
+				IsValidSize:  true,
+			},
+		},
+		{
+			name:        "File exceeding max lines",
+			content:     "1\n2\n3\n4\n5\n6",
+			maxSize:     1024,
+			maxLines:    3,
+			expectValid: true,
+			expectedResult: &ValidationResult{
+				IsValidUTF8:  true,
+				IsValidLines: false,
+				IsValidSize:  true,
+			},
+		},
+		{
+			name:        "File exceeding max size",
+			content:     "large content",
+			maxSize:     5,
+			maxLines:    10,
+			expectValid: true,
+			expectedResult: &ValidationResult{
+				IsValidUTF8:  true,
+				IsValidLines: true,
+				IsValidSize:  false,
+			},
+		},
+		{
+			name:        "Invalid UTF-8 after the first lines",
+			content:     strings.Repeat("line\n", 12) + "\xff\xfe\n",
+			maxSize:     1024,
+			maxLines:    100,
+			expectValid: true,
+			expectedResult: &ValidationResult{
+				IsValidUTF8:  true,
+				IsValidLines: true,
+				IsValidSize:  true,
+			},
+		},
+		{
+			name:        "Invalid UTF-8 after the first lines with jsonl",
+			content:     strings.Repeat("line\n", 12) + "\xff\xfe\n",
+			maxSize:     1024,
+			maxLines:    100,
+			format:      FormatJSONL,
+			expectValid: true,
+			expectedResult: &ValidationResult{
+				IsValidUTF8:  false,
+				IsValidLines: true,
+				IsValidSize:  true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestFile(t, testDir, "test.txt", tt.content)
+			config := &BalerConfig{
+				MaxInputFileSize:  tt.maxSize,
+				MaxInputFileLines: tt.maxLines,
+				Format:            tt.format,
+				Logger:            &NoopLogger{},
+			}
+
+			result, err := validateFile(NewDirFS(testDir), filepath.Base(filePath), config)
+			if err != nil && tt.expectValid {
+				t.Errorf("Expected valid file, got error: %v", err)
+			}
+
+			if result != nil {
+				if result.IsValidLines != tt.expectedResult.IsValidLines {
+					t.Errorf("Expected IsValidLines=%v, got %v",
+						tt.expectedResult.IsValidLines, result.IsValidLines)
+				}
+				if result.IsValidSize != tt.expectedResult.IsValidSize {
+					t.Errorf("Expected IsValidSize=%v, got %v",
+						tt.expectedResult.IsValidSize, result.IsValidSize)
+				}
+				if result.IsValidUTF8 != tt.expectedResult.IsValidUTF8 {
+					t.Errorf("Expected IsValidUTF8=%v, got %v",
+						tt.expectedResult.IsValidUTF8, result.IsValidUTF8)
+				}
+			}
+		})
+	}
+}
+
+func TestShouldIgnore(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		isDir        bool
+		patterns     []string
+		expectIgnore bool
+		expectError  bool
+	}{
+		{
+			name:         "Should ignore node_modules",
+			path:         "node_modules/package",
+			patterns:     []string{"node_modules/*"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Should ignore node_modules",
+			path:         "node_modules/package",
+			patterns:     []string{"node_modules*"},
+			expectIgnore: false,
+			expectError:  false,
+		},
+		{
+			name:         "Should not ignore regular file",
+			path:         "src/main.go",
+			patterns:     []string{"node_modules*", "*.tmp"},
+			expectIgnore: false,
+			expectError:  false,
+		},
+		{
+			name:         "Invalid pattern should error",
+			path:         "test.go",
+			patterns:     []string{"[invalid"},
+			expectIgnore: false,
+			expectError:  true,
+		},
+		{
+			name:         "Double asterisk matches nested node_modules",
+			path:         "frontend/app/node_modules/react/index.js",
+			patterns:     []string{"**/node_modules/**"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Double asterisk matches zero directories",
+			path:         "node_modules/react/index.js",
+			patterns:     []string{"**/node_modules/**"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Double asterisk in the middle",
+			path:         "src/a/b/__pycache__/mod.pyc",
+			patterns:     []string{"src/**/*.pyc"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Double asterisk doesn't match outside prefix",
+			path:         "lib/a/mod.pyc",
+			patterns:     []string{"src/**/*.pyc"},
+			expectIgnore: false,
+			expectError:  false,
+		},
+		{
+			name:         "Brace alternation",
+			path:         "web/index.ts",
+			patterns:     []string{"**/*.{js,ts}"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Brace alternation without match",
+			path:         "web/index.go",
+			patterns:     []string{"**/*.{js,ts}"},
+			expectIgnore: false,
+			expectError:  false,
+		},
+		{
+			name:         "Nested brace alternation",
+			path:         "vendor/lib.go",
+			patterns:     []string{"{node_modules,{vendor,third_party}}/*"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Character class",
+			path:         "logs/app3.log",
+			patterns:     []string{"logs/app[0-9].log"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Unbalanced brace should error",
+			path:         "test.go",
+			patterns:     []string{"*.{go"},
+			expectIgnore: false,
+			expectError:  true,
+		},
+		{
+			name:         "Directory with all contents excluded is pruned",
+			path:         "a/b/vendor",
+			isDir:        true,
+			patterns:     []string{"**/vendor/**"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "Directory with direct children excluded is pruned",
+			path:         "node_modules",
+			isDir:        true,
+			patterns:     []string{"node_modules/*"},
+			expectIgnore: true,
+			expectError:  false,
+		},
+		{
+			name:         "File isn't treated as a directory",
+			path:         "node_modules",
+			isDir:        false,
+			patterns:     []string{"node_modules/*"},
+			expectIgnore: false,
+			expectError:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ignore, err := shouldIgnore(tt.path, tt.isDir, &tt.patterns)
+
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if ignore != tt.expectIgnore {
+				t.Errorf("Expected ignore=%v but got %v", tt.expectIgnore, ignore)
+			}
+		})
+	}
+}
+
+func TestShouldInclude(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		patterns      []string
+		expectInclude bool
+		expectError   bool
+	}{
+		{
+			name:          "No patterns include everything",
+			path:          "src/main.go",
+			patterns:      []string{},
+			expectInclude: true,
+		},
+		{
+			name:          "Matching pattern",
+			path:          "internal/baler/convert.go",
+			patterns:      []string{"internal/**/*.{go,md}"},
+			expectInclude: true,
+		},
+		{
+			name:          "Non matching pattern",
+			path:          "cmd/baler/main.go",
+			patterns:      []string{"internal/**/*.go", "*.md"},
+			expectInclude: false,
+		},
+		{
+			name:          "Any of the patterns",
+			path:          "README.md",
+			patterns:      []string{"internal/**/*.go", "*.md"},
+			expectInclude: true,
+		},
+		{
+			name:        "Invalid pattern should error",
+			path:        "README.md",
+			patterns:    []string{"[invalid"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			include, err := shouldInclude(tt.path, &tt.patterns)
+
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if include != tt.expectInclude {
+				t.Errorf("Expected include=%v but got %v", tt.expectInclude, include)
+			}
+		})
+	}
+}
+
+func TestIntegration(t *testing.T) {
+	// TODO:
+	// 	add tests for unhappy paths,
+	//  take common parts out to run multiple testcases
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+
+	files := map[string]string{
+		"main.go":              "package main\nfunc main() {}\n",
+		"lib/helper.go":        "package lib\nfunc Helper() {}\n",
+		"node_modules/test.js": "console.log('test')",
+		"test/large_file.txt":  string(make([]byte, 1024*1024)),
+	}
+
+	writeTestTree(t, sourceDir, files)
+	logger := &mockLogger{}
+	config := &BalerConfig{
+		MaxInputFileSize:  2 * 1024 * 1024,
+		MaxInputFileLines: 1000,
+		MaxOutputFileSize: 3 * 1024 * 1024,
+		ExclusionPatterns: &[]string{"node_modules*"},
+		FileDelimiter:     "// filename: ",
+		Logger:            logger,
+		Verbose:           true,
+	}
+
+	processedFiles, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+
+	if len(*processedFiles) == 0 {
+		t.Error("Expected processed files but got none")
+	}
+	outputFiles, err := os.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("Failed to read destination directory: %v", err)
+	}
+
+	if len(outputFiles) == 0 {
+		t.Error("No output files generated")
+	}
+
+	// Verify excluded files
+	for _, file := range *processedFiles {
+		cleanPath := filepath.Clean(file)
+		cleanPrefix := filepath.Clean("node_modules")
+		relPath := filepath.ToSlash(cleanPath)
+		if strings.HasPrefix(relPath, cleanPrefix) {
+			t.Error("node_modules should have been excluded")
+		}
+	}
+
+	unconvertDir, unconvertCleanup := setupTestDir(t)
+	defer unconvertCleanup()
+
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: config.MaxOutputFileSize,
+		MaxBufferSize:    config.MaxBufferSize,
+		FileDelimiter:    config.FileDelimiter,
+		Logger:           logger,
+		Verbose:          true,
+		Operation:        OperationUnconvert,
+	}
+
+	balerErr = UnConvertDir(context.Background(), destDir, unconvertDir, unconvertConfig)
+	if balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+
+	// unconverted files match original files
+	for path, expectedContent := range files {
+		if strings.HasPrefix(path, "node_modules/") {
+			continue
+		}
+
+		unconvertedPath := filepath.Join(unconvertDir, path)
+		content, err := os.ReadFile(unconvertedPath)
+		if err != nil {
+			t.Errorf("Failed to read unconverted file %s: %v", unconvertedPath, err)
+			continue
+		}
+
+		expectedContent = strings.ReplaceAll(expectedContent, "\r\n", "\n")
+		gotContent := strings.ReplaceAll(string(content), "\r\n", "\n")
+
+		if gotContent != expectedContent {
+			t.Errorf("Content mismatch for %s\nExpected:\n%s\nGot:\n%s",
+				path, expectedContent, gotContent)
+		}
+	}
+
+	err = filepath.Walk(unconvertDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(unconvertDir, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(relPath, "node_modules") {
+			t.Errorf("Excluded file/directory was recreated: %s", relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Failed to walk unconverted directory: %v", err)
+	}
+
+	if len(logger.infoMessages) == 0 {
+		t.Error("Expected info messages in verbose mode")
+	}
+}
+
+// randomTree is a set of files with contents built from fragments
+// which are hard to round trip, generated by testing/quick
+type randomTree map[string]string
+
+var contentFragments = []string{
+	"", "a", "word", " ", "\t", "\n", "\n\n", "\r\n", "\r", "é", "世界", "😀",
+	"`", "```", "]]>", "<document path=\"x\">", "### ", "{\"path\":\"x\"}", "\\", "\"",
+	"// filename: ", "\\// filename: ",
+}
+
+func (randomTree) Generate(random *rand.Rand, size int) reflect.Value {
+	tree := randomTree{}
+	fileCount := 1 + random.Intn(5)
+	for i := 0; i < fileCount; i++ {
+		var content strings.Builder
+		fragmentCount := random.Intn(size + 1)
+		for j := 0; j < fragmentCount; j++ {
+			content.WriteString(contentFragments[random.Intn(len(contentFragments))])
+		}
+		tree[fmt.Sprintf("dir_%d/file_%d.txt", i%2, i)] = content.String()
+	}
+	return reflect.ValueOf(tree)
+}
+
+func TestRoundTripProperty(t *testing.T) {
+	for _, format := range []OutputFormat{FormatText, FormatMarkdown, FormatXML, FormatJSONL} {
+		t.Run(string(format), func(t *testing.T) {
+			roundTrip := func(tree randomTree) bool {
+				config := &BalerConfig{
+					MaxInputFileSize:  1024 * 1024,
+					MaxInputFileLines: 100000,
+					MaxOutputFileSize: 2 * 1024 * 1024,
+					ExclusionPatterns: &[]string{},
+					FileDelimiter:     "// filename: ",
+					Format:            format,
+					Logger:            &NoopLogger{},
+				}
+				unconvertConfig := &BalerConfig{
+					MaxInputFileSize: config.MaxOutputFileSize,
+					FileDelimiter:    config.FileDelimiter,
+					Format:           FormatAuto,
+					Logger:           &NoopLogger{},
+					Operation:        OperationUnconvert,
+				}
+				assertRoundTrip(t, tree, config, unconvertConfig)
+				return !t.Failed()
+			}
+			if err := quick.Check(roundTrip, &quick.Config{MaxCount: 50}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestConvertOverwrite(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+
+	createTestFile(t, sourceDir, "a.txt", strings.Repeat("a", 100))
+	createTestFile(t, sourceDir, "b.txt", strings.Repeat("b", 100))
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 150,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+	}
+	listDestination := func() []string {
+		entries, err := os.ReadDir(destDir)
+		if err != nil {
+			t.Fatalf("Failed to read destination directory: %v", err)
+		}
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	expected := []string{ManifestFileName, "output_0.txt", "output_1.txt"}
+	if names := listDestination(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v in destination directory, got %v", expected, names)
+	}
+
+	// previous output isn't replaced without Overwrite, nothing is converted
+	config.Report = &Report{}
+	_, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr == nil || balerErr.Type != ErrorTypeValidation {
+		t.Fatalf("Expected a validation error, got %v", balerErr)
+	}
+	if len(config.Report.Files) != 0 {
+		t.Errorf("Expected to fail before converting, got %+v", config.Report.Files)
+	}
+	config.Report = nil
+
+	// previous output files are removed, even when there are less new ones
+	if err := os.Remove(filepath.Join(sourceDir, "b.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	config.Overwrite = true
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	expected = []string{ManifestFileName, "output_0.txt"}
+	if names := listDestination(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v in destination directory, got %v", expected, names)
+	}
+
+	// files which weren't written by baler are never replaced
+	if err := os.Remove(filepath.Join(destDir, ManifestFileName)); err != nil {
+		t.Fatalf("Failed to remove manifest: %v", err)
+	}
+	_, balerErr = ConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr == nil || balerErr.Type != ErrorTypeValidation {
+		t.Fatalf("Expected a validation error, got %v", balerErr)
+	}
+
+	// nothing is left behind on failure
+	if err := os.Remove(filepath.Join(destDir, "output_0.txt")); err != nil {
+		t.Fatalf("Failed to remove output file: %v", err)
+	}
+	config.Format = "unknown"
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr == nil {
+		t.Fatal("Expected Convert to fail")
+	}
+	if names := listDestination(); len(names) != 0 {
+		t.Errorf("Expected an empty destination directory, got %v", names)
+	}
+}
+
+func TestConvertIntoInputDirectory(t *testing.T) {
+	sourceDir := newTestDir(t)
+	writeTestTree(t, sourceDir, map[string]string{"a.txt": "a\n", "out/.keep": ""})
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Tree:              true,
+		Overwrite:         true,
+		Logger:            &NoopLogger{},
+	}
+	// the second run replaces the output of the first one, without converting it
+	for run := 0; run < 2; run++ {
+		processedFiles, balerErr := ConvertDir(context.Background(), sourceDir, filepath.Join(sourceDir, "out"), config)
+		if balerErr != nil {
+			t.Fatalf("Convert failed: %v", balerErr)
+		}
+		expected := []string{"a.txt", "out", "out/.keep"}
+		processed := []string{}
+		for _, file := range *processedFiles {
+			processed = append(processed, filepath.ToSlash(file))
+		}
+		if !reflect.DeepEqual(processed, expected) {
+			t.Errorf("Expected processed files %v, got %v", expected, processed)
+		}
+		output, err := os.ReadFile(filepath.Join(sourceDir, "out", "output_0.txt"))
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		for _, unexpected := range []string{".baler-convert-", "output_0.txt", ManifestFileName} {
+			if strings.Contains(string(output), unexpected) {
+				t.Errorf("Expected no %s in the output, got %q", unexpected, output)
+			}
+		}
+	}
+}
+
+func TestConvertIgnoreErrors(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+
+	createTestFile(t, sourceDir, "a.txt", "a\n")
+	// a dangling link can't be read
+	if err := os.Symlink(filepath.Join(sourceDir, "missing.txt"), filepath.Join(sourceDir, "broken.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+	}
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr == nil || balerErr.Type != ErrorTypeIO {
+		t.Fatalf("Expected an I/O error, got %v", balerErr)
+	}
+
+	config.IgnoreErrors = true
+	_, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr == nil || balerErr.Type != ErrorTypePartial {
+		t.Fatalf("Expected a partial error, got %v", balerErr)
+	}
+	var multiErr *MultiError
+	if !errors.As(balerErr, &multiErr) || len(multiErr.Errors) != 1 || multiErr.Errors[0].Path != "broken.txt" {
+		t.Fatalf("Expected an error for broken.txt, got %v", balerErr)
+	}
+	content, err := os.ReadFile(filepath.Join(destDir, "output_0.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(content), "// filename: a.txt\na\n") {
+		t.Errorf("Expected a.txt to be converted, got %q", content)
+	}
+}
+
+func TestOutputFileSizeLimit(t *testing.T) {
+	// escaping and the wrapping of every format add to the size of files
+	source := fstest.MapFS{}
+	for i := 0; i < 20; i++ {
+		source[fmt.Sprintf("quotes_%02d.txt", i)] = &fstest.MapFile{Data: []byte(strings.Repeat(`"<&>`, 25) + "\n")}
+	}
+	for _, format := range []OutputFormat{FormatText, FormatMarkdown, FormatXML, FormatJSONL} {
+		t.Run(string(format), func(t *testing.T) {
+			config := &BalerConfig{
+				MaxInputFileSize:  512,
+				MaxInputFileLines: 1000,
+				MaxOutputFileSize: 1000,
+				ExclusionPatterns: &[]string{},
+				FileDelimiter:     "// filename: ",
+				Format:            format,
+				Logger:            &NoopLogger{},
+			}
+			bundle := memoryBundle{}
+			if _, balerErr := Convert(context.Background(), source, bundle, config); balerErr != nil {
+				t.Fatalf("Convert failed: %v", balerErr)
+			}
+			if len(bundle) < 3 {
+				t.Errorf("Expected several output files, got %d", len(bundle)-1)
+			}
+			for name, file := range bundle {
+				if name != ManifestFileName && len(file.Data) > 1000 {
+					t.Errorf("Expected %s to be at most 1000 bytes, got %d", name, len(file.Data))
+				}
+			}
+		})
+	}
+}
+
+func TestSkipReasons(t *testing.T) {
+	source := fstest.MapFS{
+		"ok.txt":     {Data: []byte("ok\n")},
+		"big.txt":    {Data: []byte(strings.Repeat("x", 2048))},
+		"long.txt":   {Data: []byte(strings.Repeat("line\n", 20))},
+		"binary.dat": {Data: []byte{0xff, 0xfe, 0x00}},
+		"latin1.txt": {Data: []byte("caf\xe9\n")},
+		"debug.log":  {Data: []byte("log\n")},
+		"main.go":    {Data: []byte("package main\n")},
+	}
+	logger := &mockLogger{}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 10,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{"*.log"},
+		IncludePatterns:   &[]string{"*.txt", "*.dat", "*.log"},
+		FileDelimiter:     "// filename: ",
+		Logger:            logger,
+		Verbose:           true,
+	}
+	if _, balerErr := Convert(context.Background(), source, memoryBundle{}, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	skipped := map[string]logRecord{}
+	for _, record := range logger.infoMessages {
+		if record.msg == "Skipping file" {
+			skipped[record.attrs["path"].(string)] = record
+		}
+	}
+
+	tests := []struct {
+		path   string
+		reason SkipReason
+		attrs  map[string]any
+	}{
+		{"big.txt", SkipTooLarge, map[string]any{"size": uint64(2048)}},
+		{"long.txt", SkipTooManyLines, map[string]any{"size": uint64(100), "lines": uint64(20)}},
+		{"binary.dat", SkipBinary, map[string]any{"size": uint64(3)}},
+		{"latin1.txt", SkipNotUTF8, map[string]any{"size": uint64(5), "lines": uint64(1)}},
+		{"debug.log", SkipExcluded, map[string]any{"pattern": "*.log"}},
+		{"main.go", SkipNotIncluded, map[string]any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			record, ok := skipped[tt.path]
+			if !ok {
+				t.Fatalf("Expected %s to be logged as skipped", tt.path)
+			}
+			if record.attrs["reason"] != tt.reason {
+				t.Errorf("Expected reason %q, got %v", tt.reason, record.attrs["reason"])
+			}
+			for key, expected := range tt.attrs {
+				if record.attrs[key] != expected {
+					t.Errorf("Expected %s = %v, got %v", key, expected, record.attrs[key])
+				}
+			}
+		})
+	}
+	if _, ok := skipped["ok.txt"]; ok {
+		t.Error("Expected ok.txt to be converted")
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	sourceDir := newTestDir(t)
+
+	files := map[string]string{
+		"a.txt":     strings.Repeat("a", 100) + "\n",
+		"b/c.txt":   strings.Repeat("c", 100),
+		"b/d/e.txt": "e\n",
+	}
+	writeTestTree(t, sourceDir, files)
+	for _, format := range []OutputFormat{FormatText, FormatMarkdown, FormatXML, FormatJSONL} {
+		t.Run(string(format), func(t *testing.T) {
+			config := &BalerConfig{
+				MaxInputFileSize:  1024,
+				MaxInputFileLines: 100,
+				// smaller than the stream, which isn't split
+				MaxOutputFileSize: 150,
+				ExclusionPatterns: &[]string{},
+				FileDelimiter:     "// filename: ",
+				Format:            format,
+				Logger:            &NoopLogger{},
+			}
+			var stream bytes.Buffer
+			if _, balerErr := Convert(context.Background(), NewDirFS(sourceDir), NewStreamBundleWriter(&stream), config); balerErr != nil {
+				t.Fatalf("Convert failed: %v", balerErr)
+			}
+			if format == FormatXML && strings.Count(stream.String(), "<documents") != 1 {
+				t.Errorf("Expected a single document list, got %q", stream.String())
+			}
+			unconvertDir := newTestDir(t)
+			unconvertConfig := &BalerConfig{
+				MaxInputFileSize: 4096,
+				FileDelimiter:    "// filename: ",
+				Format:           FormatAuto,
+				Logger:           &NoopLogger{},
+				Operation:        OperationUnconvert,
+			}
+			if balerErr := UnConvert(context.Background(), NewStreamBundleReader(&stream), NewDirFS(unconvertDir), unconvertConfig); balerErr != nil {
+				t.Fatalf("Unconvert failed: %v", balerErr)
+			}
+			assertTestTree(t, unconvertDir, files)
+		})
+	}
+}
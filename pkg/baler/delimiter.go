@@ -0,0 +1,93 @@
+package baler
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DelimiterAuto picks a delimiter which doesn't begin any line of the input
+// while converting, and detects it while unconverting
+const DelimiterAuto = "auto"
+
+// delimiterEscape is prepended to content lines beginning with the delimiter,
+// including lines already escaped, so the parser can drop exactly one
+const delimiterEscape = `\`
+
+// autoDelimiterPattern matches the delimiters chosen by DelimiterAuto,
+// i.e "// filename: ", "/// filename: " and so on
+var autoDelimiterPattern = regexp.MustCompile(`^(/{2,}) filename: `)
+
+// validateDelimiter checks the delimiter of the text format
+func validateDelimiter(delimiter string) *BalerError {
+	if strings.TrimSpace(delimiter) == "" {
+		return NewConfigError("delimiter can't be empty", nil)
+	}
+	if strings.HasPrefix(delimiter, delimiterEscape) {
+		return NewConfigError(fmt.Sprintf("delimiter can't begin with '%s'", delimiterEscape), nil)
+	}
+	return nil
+}
+
+// needsEscape reports whether line is delimiterEscape repeated
+// any number of times, followed by delimiter
+func needsEscape(line string, delimiter string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, delimiterEscape), delimiter)
+}
+
+// escapeDelimiterLines escapes the lines of content which would
+// otherwise be read as the beginning of a new file
+func escapeDelimiterLines(content []byte, delimiter string) []byte {
+	var buffer bytes.Buffer
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if needsEscape(string(line), delimiter) {
+			buffer.WriteString(delimiterEscape)
+		}
+		buffer.Write(line)
+	}
+	return buffer.Bytes()
+}
+
+// unescapeDelimiterLine reverts escapeDelimiterLines for a single line
+func unescapeDelimiterLine(line string, delimiter string) string {
+	if strings.HasPrefix(line, delimiterEscape) && needsEscape(line, delimiter) {
+		return strings.TrimPrefix(line, delimiterEscape)
+	}
+	return line
+}
+
+func autoDelimiter(slashes int) string {
+	return strings.Repeat("/", slashes) + " filename: "
+}
+
+// chooseDelimiter returns the shortest delimiter matching autoDelimiterPattern
+// which doesn't begin any line of the files to be converted
+func chooseDelimiter(files []*sourceFile) string {
+	// slash counts of the lines matching autoDelimiterPattern
+	used := make(map[int]bool)
+	for _, file := range files {
+		// files which can't be read are skipped while converting
+		if file == nil || file.err != nil {
+			continue
+		}
+		for _, slashes := range file.delimiterSlashes {
+			used[slashes] = true
+		}
+	}
+	slashes := 2
+	for used[slashes] {
+		slashes++
+	}
+	return autoDelimiter(slashes)
+}
+
+// detectDelimiter returns the delimiter chosen by DelimiterAuto, from the
+// first line of an output file matching autoDelimiterPattern
+func detectDelimiter(line string) (string, bool) {
+	match := autoDelimiterPattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	return autoDelimiter(len(match[1])), true
+}
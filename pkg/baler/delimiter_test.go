@@ -0,0 +1,122 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEscapeDelimiterLines(t *testing.T) {
+	delimiter := "// filename: "
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "No collision", content: "a\n  // filename: x\n", expected: "a\n  // filename: x\n"},
+		{name: "Collision", content: "// filename: x\nb", expected: "\\// filename: x\nb"},
+		{name: "Collision after new line", content: "a\n// filename: x", expected: "a\n\\// filename: x"},
+		{name: "Escaped collision", content: "\\\\// filename: x\n", expected: "\\\\\\// filename: x\n"},
+		{name: "Backslash without delimiter", content: "\\n\n\\// file\n", expected: "\\n\n\\// file\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped := string(escapeDelimiterLines([]byte(tt.content), delimiter))
+			if escaped != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, escaped)
+			}
+			var unescaped strings.Builder
+			for _, line := range strings.SplitAfter(escaped, "\n") {
+				unescaped.WriteString(unescapeDelimiterLine(line, delimiter))
+			}
+			if unescaped.String() != tt.content {
+				t.Errorf("Expected %q after unescaping, got %q", tt.content, unescaped.String())
+			}
+		})
+	}
+}
+
+func TestDelimiterIntegration(t *testing.T) {
+	files := map[string]string{
+		"main.go":    "package main\n// filename: main.go\n/// filename: other.go\n",
+		"escaped.go": "\\// filename: x\n",
+		"plain.txt":  "hello",
+	}
+	tests := []struct {
+		name              string
+		delimiter         string
+		expectedDelimiter string
+	}{
+		{name: "Escaped", delimiter: "// filename: ", expectedDelimiter: "// filename: "},
+		{name: "Auto", delimiter: DelimiterAuto, expectedDelimiter: "//// filename: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &BalerConfig{
+				MaxInputFileSize:  1024,
+				MaxInputFileLines: 100,
+				MaxOutputFileSize: 4096,
+				ExclusionPatterns: &[]string{},
+				FileDelimiter:     tt.delimiter,
+				Logger:            &NoopLogger{},
+			}
+			destDir := convertTestTree(t, files, config)
+			output, err := os.ReadFile(filepath.Join(destDir, "output_0.txt"))
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if !strings.Contains(string(output), tt.expectedDelimiter+"plain.txt\n") {
+				t.Errorf("Expected delimiter %q in output:\n%s", tt.expectedDelimiter, output)
+			}
+
+			unconvertConfig := &BalerConfig{
+				MaxInputFileSize: config.MaxOutputFileSize,
+				FileDelimiter:    tt.delimiter,
+				Format:           FormatAuto,
+				Logger:           &NoopLogger{},
+				Operation:        OperationUnconvert,
+			}
+			assertTestTree(t, unconvertTestTree(t, destDir, unconvertConfig), files)
+		})
+	}
+}
+
+func TestAutoDelimiterWithoutManifest(t *testing.T) {
+	files := map[string]string{
+		"main.go":  "package main\n// filename: evil\n",
+		"other.go": "// filename: other\n",
+	}
+	sourceDir := newTestDir(t)
+	writeTestTree(t, sourceDir, files)
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     DelimiterAuto,
+		Logger:            &NoopLogger{},
+	}
+	var stream bytes.Buffer
+	if _, balerErr := Convert(context.Background(), NewDirFS(sourceDir), NewStreamBundleWriter(&stream), config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	// the delimiter of the stream is detected, not the configured one
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	unconvertDir := newTestDir(t)
+	if balerErr := UnConvert(context.Background(), NewStreamBundleReader(&stream), NewDirFS(unconvertDir), unconvertConfig); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	assertTestTree(t, unconvertDir, files)
+	if _, err := os.Stat(filepath.Join(unconvertDir, "evil")); err == nil {
+		t.Error("Expected no file named after a content line")
+	}
+}
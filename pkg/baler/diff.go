@@ -0,0 +1,253 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// FileDiff is a file which baler unconvert would create or change
+type FileDiff struct {
+	// slash separated path relative to the directory
+	Path string
+	// content in the directory, nil when the file doesn't exist
+	Old []byte
+	// content in the output files of baler convert
+	New []byte
+}
+
+// diffOp is an edit of a line by the diff, ' ', '-' or '+'
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits content after every new line
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script turning a into b, with
+// the algorithm from Myers' "An O(ND) Difference Algorithm and Its Variations"
+func diffLines(a []string, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	// v holds the furthest x reached on every diagonal k = x - y,
+	// one copy per edit distance d to backtrack the path. k+1 is read on
+	// every diagonal, including k = d = 0 when both are empty
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	trace = append(trace, v)
+
+	// backtrack from (n, m), trace[d+1] holds v after step d
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 2; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var previousK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+		previousX := v[offset+previousK]
+		previousY := previousX - previousK
+		for x > previousX && y > previousY {
+			x--
+			y--
+			ops = append(ops, diffOp{kind: ' ', line: a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == previousX {
+			y--
+			ops = append(ops, diffOp{kind: '+', line: b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{kind: '-', line: a[x]})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Stat returns the number of inserted and deleted lines
+func (d *FileDiff) Stat() (int, int) {
+	insertions, deletions := 0, 0
+	for _, op := range diffLines(splitLines(d.Old), splitLines(d.New)) {
+		switch op.kind {
+		case '+':
+			insertions++
+		case '-':
+			deletions++
+		}
+	}
+	return insertions, deletions
+}
+
+// formatRange formats the range of a hunk header, like GNU diff
+func formatRange(start int, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// Unified returns the diff in the unified format with git style headers,
+// and contextLines unchanged lines around every change
+func (d *FileDiff) Unified(contextLines int) string {
+	var buffer strings.Builder
+	buffer.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", d.Path, d.Path))
+	if d.Old == nil {
+		buffer.WriteString("new file mode 100644\n")
+		// like git, empty new files have no hunk and no file names
+		if len(d.New) == 0 {
+			return buffer.String()
+		}
+		buffer.WriteString("--- /dev/null\n")
+	} else {
+		buffer.WriteString(fmt.Sprintf("--- a/%s\n", d.Path))
+	}
+	buffer.WriteString(fmt.Sprintf("+++ b/%s\n", d.Path))
+
+	ops := diffLines(splitLines(d.Old), splitLines(d.New))
+	// line numbers before every op
+	oldLines := make([]int, len(ops)+1)
+	newLines := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLines[i+1], newLines[i+1] = oldLines[i], newLines[i]
+		if op.kind != '+' {
+			oldLines[i+1]++
+		}
+		if op.kind != '-' {
+			newLines[i+1]++
+		}
+	}
+
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// a hunk spans changes separated by at most 2 * contextLines unchanged lines
+		hunkStart := start - contextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*contextLines {
+				break
+			}
+			end = next
+		}
+		hunkEnd := end + contextLines
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+		buffer.WriteString(fmt.Sprintf(
+			"@@ -%s +%s @@\n",
+			formatRange(oldLines[hunkStart]+1, oldLines[hunkEnd]-oldLines[hunkStart]),
+			formatRange(newLines[hunkStart]+1, newLines[hunkEnd]-newLines[hunkStart]),
+		))
+		for i := hunkStart; i < hunkEnd; i++ {
+			op := ops[i]
+			buffer.WriteByte(op.kind)
+			buffer.WriteString(op.line)
+			// only the last line of a file can miss the new line
+			if !strings.HasSuffix(op.line, "\n") {
+				buffer.WriteString("\n" + noNewlineMarker + "\n")
+			}
+		}
+		start = hunkEnd
+	}
+	return buffer.String()
+}
+
+// Diff compares the bundle src with dst, and returns the files UnConvert
+// would create or change, sorted by path. Files are planned like
+// PlanUnConvert, conflicting files fail the diff like they fail UnConvert,
+// or are left out with IgnoreErrors.
+func Diff(ctx context.Context, src BundleReader, dst fs.FS, config *BalerConfig) ([]FileDiff, *BalerError) {
+	errs := newErrorCollector(config)
+	plan, balerErr := planUnConvert(ctx, src, dst, config, errs)
+	if balerErr != nil {
+		return nil, balerErr
+	}
+	if balerErr := checkConflicts(plan, config, errs); balerErr != nil {
+		return nil, balerErr
+	}
+	diffs := []FileDiff{}
+	for _, planned := range plan.Files {
+		if balerErr := checkCanceled(ctx); balerErr != nil {
+			return nil, balerErr
+		}
+		name := fsName(planned.Path)
+		switch planned.Action {
+		case PlanCreate:
+			diffs = append(diffs, FileDiff{Path: name, New: planned.entry.Content})
+		case PlanOverwrite:
+			existing, err := fs.ReadFile(dst, name)
+			if err != nil {
+				return nil, NewIOError(fmt.Sprintf("unable to read: %s", displayPath(dst, name)), err)
+			}
+			// only the permissions change
+			if bytes.Equal(existing, planned.entry.Content) {
+				continue
+			}
+			if existing == nil {
+				existing = []byte{}
+			}
+			diffs = append(diffs, FileDiff{Path: name, Old: existing, New: planned.entry.Content})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs, errs.result()
+}
@@ -0,0 +1,178 @@
+package baler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      []byte
+		new      string
+		context  int
+		expected string
+	}{
+		{
+			name:    "New file",
+			old:     nil,
+			new:     "a\nb\n",
+			context: 3,
+			expected: "diff --git a/f.txt b/f.txt\nnew file mode 100644\n--- /dev/null\n+++ b/f.txt\n" +
+				"@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "New empty file",
+			old:      nil,
+			new:      "",
+			context:  3,
+			expected: "diff --git a/f.txt b/f.txt\nnew file mode 100644\n",
+		},
+		{
+			name:     "Empty file unchanged",
+			old:      []byte{},
+			new:      "",
+			context:  3,
+			expected: "diff --git a/f.txt b/f.txt\n--- a/f.txt\n+++ b/f.txt\n",
+		},
+		{
+			name:    "Changed line with context",
+			old:     []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"),
+			new:     "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			context: 2,
+			expected: "diff --git a/f.txt b/f.txt\n--- a/f.txt\n+++ b/f.txt\n" +
+				"@@ -3,5 +3,5 @@\n 3\n 4\n-5\n+five\n 6\n 7\n",
+		},
+		{
+			name:    "Separate hunks",
+			old:     []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"),
+			new:     "one\n2\n3\n4\n5\n6\n7\n8\nnine\n",
+			context: 1,
+			expected: "diff --git a/f.txt b/f.txt\n--- a/f.txt\n+++ b/f.txt\n" +
+				"@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -8,2 +8,2 @@\n 8\n-9\n+nine\n",
+		},
+		{
+			name:    "Missing new line",
+			old:     []byte("a\nb"),
+			new:     "a\nb\n",
+			context: 3,
+			expected: "diff --git a/f.txt b/f.txt\n--- a/f.txt\n+++ b/f.txt\n" +
+				"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := &FileDiff{Path: "f.txt", Old: tt.old, New: []byte(tt.new)}
+			if unified := diff.Unified(tt.context); unified != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, unified)
+			}
+			// Stat shares the edit script of Unified
+			diff.Stat()
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+	targetDir, targetCleanup := setupTestDir(t)
+	defer targetCleanup()
+
+	createTestFile(t, sourceDir, "same.txt", "same\n")
+	createTestFile(t, sourceDir, "changed.txt", "a\nb\nc\n")
+	createTestFile(t, sourceDir, "new.txt", "new\n")
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+	}
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	createTestFile(t, targetDir, "same.txt", "same\n")
+	createTestFile(t, targetDir, "changed.txt", "a\nB\nc\n")
+	createTestFile(t, targetDir, "only_in_target.txt", "kept\n")
+
+	diffConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	diffs, balerErr := Diff(context.Background(), NewDirBundleReader(destDir), NewDirFS(targetDir), diffConfig)
+	if balerErr != nil {
+		t.Fatalf("Diff failed: %v", balerErr)
+	}
+	if len(diffs) != 2 || diffs[0].Path != "changed.txt" || diffs[1].Path != "new.txt" {
+		t.Fatalf("Expected diffs for changed.txt and new.txt, got %+v", diffs)
+	}
+	if diffs[1].Old != nil {
+		t.Error("Expected new.txt to be missing from the target directory")
+	}
+	if insertions, deletions := diffs[0].Stat(); insertions != 1 || deletions != 1 {
+		t.Errorf("Expected 1 insertion and 1 deletion, got %d and %d", insertions, deletions)
+	}
+}
+
+func TestDiffPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		bundle   string
+		target   map[string]string
+		paths    []string
+		errorMsg string
+	}{
+		{
+			name:   "Same file twice",
+			bundle: "// filename: ./a.txt\nfirst\n// filename: a.txt\nsecond\n",
+			paths:  []string{"a.txt"},
+		},
+		{
+			name:     "Directory on disk",
+			bundle:   "// filename: a.txt\na\n// filename: dir\nb\n",
+			target:   map[string]string{"dir/b.txt": "b\n"},
+			errorMsg: "1 file(s) can't be written, e.g/ dir: is a directory on disk",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundleDir, targetDir := newTestDir(t), newTestDir(t)
+			writeTestTree(t, bundleDir, map[string]string{"output_0.txt": tt.bundle})
+			writeTestTree(t, targetDir, tt.target)
+			config := &BalerConfig{
+				MaxInputFileSize: 4096,
+				FileDelimiter:    "// filename: ",
+				Format:           FormatText,
+				Logger:           &NoopLogger{},
+				Operation:        OperationUnconvert,
+			}
+			diffs, balerErr := Diff(context.Background(), NewDirBundleReader(bundleDir), NewDirFS(targetDir), config)
+			if tt.errorMsg != "" {
+				if balerErr == nil || balerErr.Type != ErrorTypeValidation || balerErr.Message != tt.errorMsg {
+					t.Fatalf("Expected validation error %q, got %v", tt.errorMsg, balerErr)
+				}
+				return
+			}
+			if balerErr != nil {
+				t.Fatalf("Diff failed: %v", balerErr)
+			}
+			var paths []string
+			for _, diff := range diffs {
+				paths = append(paths, diff.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("Expected diffs for %v, got %v", tt.paths, paths)
+			}
+			if string(diffs[0].New) != "second" {
+				t.Errorf("Expected the last entry, got %q", diffs[0].New)
+			}
+		})
+	}
+}
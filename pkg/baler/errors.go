@@ -0,0 +1,167 @@
+package baler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type ErrorType int
+
+const (
+	ErrorTypeValidation ErrorType = iota
+	ErrorTypeIO
+	ErrorTypeConfig
+	ErrorTypeInternal
+	// ErrorTypePartial is returned when IgnoreErrors let baler complete
+	// despite errors, which are wrapped in a MultiError
+	ErrorTypePartial
+	// ErrorTypeCanceled is returned when the context of Convert or
+	// UnConvert is done, it wraps the error of the context
+	ErrorTypeCanceled
+)
+
+type BalerError struct {
+	Type    ErrorType
+	Message string
+	Err     error
+}
+
+func (e *BalerError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s\n%v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *BalerError) Unwrap() error {
+	return e.Err
+}
+
+// check if constructors can return BalerError
+func NewValidationError(message string, err error) *BalerError {
+	return &BalerError{
+		Type:    ErrorTypeValidation,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func NewIOError(message string, err error) *BalerError {
+	return &BalerError{
+		Type:    ErrorTypeIO,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func NewConfigError(message string, err error) *BalerError {
+	return &BalerError{
+		Type:    ErrorTypeConfig,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func NewInternalError(message string, err error) *BalerError {
+	return &BalerError{
+		Type:    ErrorTypeInternal,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func NewCanceledError(message string, err error) *BalerError {
+	return &BalerError{
+		Type:    ErrorTypeCanceled,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// checkCanceled returns a canceled error once ctx is done
+func checkCanceled(ctx context.Context) *BalerError {
+	if err := ctx.Err(); err != nil {
+		return NewCanceledError("canceled", err)
+	}
+	return nil
+}
+
+// FileError is an error which stopped a single file from being processed
+type FileError struct {
+	// relative path of the file, or the output file while unconverting
+	Path string
+	Err  *BalerError
+}
+
+// MultiError is the list of errors ignored with IgnoreErrors
+type MultiError struct {
+	Errors []FileError
+}
+
+func (e *MultiError) Error() string {
+	var builder strings.Builder
+	for i, fileError := range e.Errors {
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		builder.WriteString(fmt.Sprintf("%s: %s", fileError.Path, fileError.Err.Message))
+	}
+	return builder.String()
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fileError := range e.Errors {
+		errs[i] = fileError.Err
+	}
+	return errs
+}
+
+func NewPartialError(errs []FileError) *BalerError {
+	return &BalerError{
+		Type:    ErrorTypePartial,
+		Message: fmt.Sprintf("completed with %d error(s)", len(errs)),
+		Err:     &MultiError{Errors: errs},
+	}
+}
+
+// errorCollector gathers the errors of single files with IgnoreErrors
+type errorCollector struct {
+	config *BalerConfig
+	errors []FileError
+}
+
+func newErrorCollector(config *BalerConfig) *errorCollector {
+	return &errorCollector{config: config}
+}
+
+// handle returns balerErr, or records it and returns nil with IgnoreErrors.
+// Cancellations are always returned.
+func (c *errorCollector) handle(path string, balerErr *BalerError) *BalerError {
+	if balerErr == nil || !c.config.IgnoreErrors || balerErr.Type == ErrorTypeCanceled {
+		return balerErr
+	}
+	c.errors = append(c.errors, FileError{Path: path, Err: balerErr})
+	c.config.Report.skip(path, SkipError, 0, balerErr.Message)
+	c.config.Logger.Warn("Skipping file", "path", path, "reason", SkipError, "error", balerErr.Message)
+	return nil
+}
+
+// result returns a partial error with the recorded errors, or nil
+func (c *errorCollector) result() *BalerError {
+	if len(c.errors) == 0 {
+		return nil
+	}
+	return NewPartialError(c.errors)
+}
+
+func IsBalerError(err error) (*BalerError, bool) {
+	var balerErr *BalerError
+	if err == nil {
+		return nil, false
+	}
+	ok := errors.As(err, &balerErr)
+	return balerErr, ok
+}
@@ -0,0 +1,614 @@
+package baler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type OutputFormat string
+
+const (
+	FormatText     OutputFormat = "text"
+	FormatMarkdown OutputFormat = "markdown"
+	FormatXML      OutputFormat = "xml"
+	FormatJSONL    OutputFormat = "jsonl"
+	// FormatAuto detects the format of each output file while unconverting
+	FormatAuto OutputFormat = "auto"
+)
+
+// bundleEntry is a single file stored in the output files of baler
+type bundleEntry struct {
+	// slash separated path relative to the converted directory
+	Path    string
+	Content []byte
+	// permission bits, 0 when the format doesn't store them
+	Mode fs.FileMode
+}
+
+// bundleFormatter writes files into the output files of baler convert
+type bundleFormatter interface {
+	// prologue is written at the beginning of every output file
+	prologue() []byte
+	// formatTree wraps the directory tree written after the prologue of the
+	// first output file, so that parsers don't read it as a file
+	formatTree(tree []byte) []byte
+	formatEntry(entry *bundleEntry) []byte
+	// epilogue is written at the end of every output file
+	epilogue() []byte
+}
+
+// bundleParser reads files back from an output file of baler convert
+type bundleParser interface {
+	// parse calls emit for every file found in reader, in order
+	// name is only used in error messages
+	parse(name string, reader io.Reader, emit func(entry *bundleEntry) *BalerError) *BalerError
+}
+
+// ParseOutputFormat validates a format name, "" defaults to FormatText
+func ParseOutputFormat(name string) (OutputFormat, *BalerError) {
+	switch OutputFormat(name) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatMarkdown, FormatXML, FormatJSONL, FormatAuto:
+		return OutputFormat(name), nil
+	}
+	return "", NewConfigError(
+		fmt.Sprintf(
+			"unknown format: %s. Supported formats are '%s', '%s', '%s', '%s' and '%s' (unconvert only)",
+			name, FormatText, FormatMarkdown, FormatXML, FormatJSONL, FormatAuto,
+		),
+		nil,
+	)
+}
+
+func newBundleFormatter(config *BalerConfig) (bundleFormatter, *BalerError) {
+	format, balerErr := ParseOutputFormat(string(config.Format))
+	if balerErr != nil {
+		return nil, balerErr
+	}
+	switch format {
+	case FormatMarkdown:
+		return &markdownFormatter{}, nil
+	case FormatXML:
+		return &xmlFormatter{}, nil
+	case FormatJSONL:
+		return &jsonlFormatter{}, nil
+	case FormatAuto:
+		return nil, NewConfigError("format 'auto' can only be used to unconvert", nil)
+	}
+	if config.FileDelimiter == DelimiterAuto {
+		return nil, NewInternalError("delimiter 'auto' has to be resolved before formatting", nil)
+	}
+	if balerErr := validateDelimiter(config.FileDelimiter); balerErr != nil {
+		return nil, balerErr
+	}
+	return &textFormatter{delimiter: config.FileDelimiter}, nil
+}
+
+func newBundleParser(config *BalerConfig) (bundleParser, *BalerError) {
+	format, balerErr := ParseOutputFormat(string(config.Format))
+	if balerErr != nil {
+		return nil, balerErr
+	}
+	switch format {
+	case FormatMarkdown:
+		return &markdownParser{config: config}, nil
+	case FormatXML:
+		return &xmlParser{config: config}, nil
+	case FormatJSONL:
+		return &jsonlParser{config: config}, nil
+	case FormatAuto:
+		return &autoParser{config: config}, nil
+	}
+	if config.FileDelimiter != DelimiterAuto {
+		if balerErr := validateDelimiter(config.FileDelimiter); balerErr != nil {
+			return nil, balerErr
+		}
+	}
+	return &textParser{config: config}, nil
+}
+
+// detectFormat guesses the format of an output file from its beginning
+func detectFormat(head []byte, config *BalerConfig) OutputFormat {
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case config.FileDelimiter == DelimiterAuto && autoDelimiterPattern.MatchString(line):
+			return FormatText
+		case config.FileDelimiter != "" && strings.HasPrefix(line, strings.TrimSpace(config.FileDelimiter)):
+			return FormatText
+		case strings.HasPrefix(line, "<documents") || strings.HasPrefix(line, "<?xml"):
+			return FormatXML
+		case strings.HasPrefix(line, markdownHeadingPrefix) || line == markdownTreeHeading:
+			return FormatMarkdown
+		case strings.HasPrefix(line, "{"):
+			return FormatJSONL
+		default:
+			return FormatText
+		}
+	}
+	return FormatText
+}
+
+// autoParser detects the format of every output file before parsing it
+type autoParser struct {
+	config *BalerConfig
+}
+
+func (p *autoParser) parse(name string, reader io.Reader, emit func(entry *bundleEntry) *BalerError) *BalerError {
+	bufferedReader := bufio.NewReaderSize(reader, 4096)
+	// a short file returns io.EOF along with its content
+	head, err := bufferedReader.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return NewIOError(fmt.Sprintf("unable to read file: %s", name), err)
+	}
+	formatConfig := *p.config
+	formatConfig.Format = detectFormat(head, p.config)
+	if p.config.Verbose {
+		p.config.Logger.Info("Detected format", "output_file", name, "format", formatConfig.Format)
+	}
+	parser, balerErr := newBundleParser(&formatConfig)
+	if balerErr != nil {
+		return balerErr
+	}
+	return parser.parse(name, bufferedReader, emit)
+}
+
+// scanRawLines is a bufio.SplitFunc like bufio.ScanLines, which keeps
+// line endings so that the content can be reproduced byte by byte
+func scanRawLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func newScanError(name string, err error) *BalerError {
+	return NewIOError(
+		fmt.Sprintf(
+			"error scanning file: %s.\nPlease try setting an increased '--max-input-file-size' or '--max-buffer-size'",
+			name,
+		),
+		err,
+	)
+}
+
+// text format
+//
+// <delimiter><path>
+// <content>
+// <new line>
+//
+// The new line terminating every file is dropped while parsing, so that
+// files which don't end with a new line are restored exactly. Content
+// lines beginning with the delimiter are escaped, see escapeDelimiterLines.
+const textTreeHeading = "Directory tree:"
+
+type textFormatter struct {
+	delimiter string
+}
+
+func (f *textFormatter) prologue() []byte {
+	return nil
+}
+
+func (f *textFormatter) epilogue() []byte {
+	return nil
+}
+
+// lines before the first delimiter are ignored while parsing
+func (f *textFormatter) formatTree(tree []byte) []byte {
+	header := append([]byte(textTreeHeading+"\n"), tree...)
+	return append(escapeDelimiterLines(header, f.delimiter), '\n')
+}
+
+func (f *textFormatter) formatEntry(entry *bundleEntry) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(f.delimiter + entry.Path + "\n")
+	buffer.Write(escapeDelimiterLines(entry.Content, f.delimiter))
+	buffer.WriteString("\n")
+	return buffer.Bytes()
+}
+
+type textParser struct {
+	config *BalerConfig
+}
+
+func (p *textParser) parse(name string, reader io.Reader, emit func(entry *bundleEntry) *BalerError) *BalerError {
+	var current *bundleEntry
+	// drops the new line terminating every file
+	finish := func() *BalerError {
+		if current == nil {
+			return nil
+		}
+		current.Content = bytes.TrimSuffix(current.Content, []byte("\n"))
+		return emit(current)
+	}
+	delimiter := p.config.FileDelimiter
+	scanner := customScanner(reader, p.config)
+	scanner.Split(scanRawLines)
+	for scanner.Scan() {
+		rawLine := scanner.Text()
+
+		// the first file begins the first line matching autoDelimiterPattern,
+		// also with another delimiter when it doesn't match, e.g/ the output of
+		// DelimiterAuto read without its manifest. Lines before it are dropped.
+		if current == nil && (delimiter == DelimiterAuto || !strings.HasPrefix(rawLine, delimiter)) {
+			detected, ok := detectDelimiter(rawLine)
+			if !ok {
+				continue
+			}
+			delimiter = detected
+			if p.config.Verbose {
+				p.config.Logger.Info("Detected delimiter", "output_file", name, "delimiter", delimiter)
+			}
+		}
+
+		if strings.HasPrefix(rawLine, delimiter) {
+			if balerErr := finish(); balerErr != nil {
+				return balerErr
+			}
+			current = &bundleEntry{
+				Path:    strings.TrimSpace(strings.TrimPrefix(rawLine, delimiter)),
+				Content: []byte{},
+			}
+			continue
+		}
+
+		if current != nil {
+			current.Content = append(current.Content, unescapeDelimiterLine(rawLine, delimiter)...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return newScanError(name, err)
+	}
+	return finish()
+}
+
+// markdown format
+//
+// ### <path>
+//
+// ```<language>
+// <content>
+// ```
+//
+// The fence is longer than any backtick run in the content. Content which
+// doesn't end with a new line is followed by noNewlineMarker.
+type markdownFormatter struct{}
+
+const markdownHeadingPrefix = "### "
+const markdownTreeHeading = "## Directory tree"
+const noNewlineMarker = "\\ No newline at end of file"
+
+// markdownFence returns a backtick fence longer than any backtick run in content
+func markdownFence(content []byte) string {
+	longestRun, run := 0, 0
+	for _, b := range content {
+		if b == '`' {
+			run++
+			longestRun = max(longestRun, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longestRun+1))
+}
+
+func (f *markdownFormatter) prologue() []byte {
+	return nil
+}
+
+func (f *markdownFormatter) epilogue() []byte {
+	return nil
+}
+
+// code blocks which don't follow a file heading are ignored while parsing
+func (f *markdownFormatter) formatTree(tree []byte) []byte {
+	fence := markdownFence(tree)
+	return []byte(fmt.Sprintf("%s\n\n%s\n%s%s\n", markdownTreeHeading, fence, tree, fence))
+}
+
+func (f *markdownFormatter) formatEntry(entry *bundleEntry) []byte {
+	var buffer bytes.Buffer
+	fence := markdownFence(entry.Content)
+	fmt.Fprintf(&buffer, "\n%s%s\n\n%s%s\n", markdownHeadingPrefix, entry.Path, fence, inferLanguage(entry.Path))
+	buffer.Write(entry.Content)
+	missingNewline := len(entry.Content) > 0 && !bytes.HasSuffix(entry.Content, []byte("\n"))
+	if missingNewline {
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString(fence + "\n")
+	if missingNewline {
+		buffer.WriteString(noNewlineMarker + "\n")
+	}
+	return buffer.Bytes()
+}
+
+type markdownParser struct {
+	config *BalerConfig
+}
+
+func (p *markdownParser) parse(name string, reader io.Reader, emit func(entry *bundleEntry) *BalerError) *BalerError {
+	const (
+		outside = iota
+		// after a heading, waiting for the opening fence
+		heading
+		// inside a code block
+		code
+		// after the closing fence, waiting for noNewlineMarker
+		closed
+	)
+	state := outside
+	var current *bundleEntry
+	var fence string
+
+	scanner := customScanner(reader, p.config)
+	scanner.Split(scanRawLines)
+	for scanner.Scan() {
+		rawLine := scanner.Text()
+		line := strings.TrimRight(rawLine, "\r\n")
+
+		if state == closed {
+			if line == noNewlineMarker {
+				current.Content = bytes.TrimSuffix(current.Content, []byte("\n"))
+			}
+			if balerErr := emit(current); balerErr != nil {
+				return balerErr
+			}
+			current = nil
+			state = outside
+			if line == noNewlineMarker {
+				continue
+			}
+		}
+
+		switch state {
+		case outside:
+			if strings.HasPrefix(line, markdownHeadingPrefix) {
+				current = &bundleEntry{
+					Path:    strings.TrimSpace(strings.TrimPrefix(line, markdownHeadingPrefix)),
+					Content: []byte{},
+				}
+				state = heading
+			}
+		case heading:
+			if strings.HasPrefix(line, "```") {
+				fence = line[:len(line)-len(strings.TrimLeft(line, "`"))]
+				state = code
+			} else if strings.TrimSpace(line) != "" {
+				// a heading which isn't followed by a code block isn't a file
+				current = nil
+				state = outside
+			}
+		case code:
+			if strings.TrimRight(line, " \t") == fence {
+				state = closed
+			} else {
+				current.Content = append(current.Content, rawLine...)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return newScanError(name, err)
+	}
+	if state == code {
+		return NewValidationError(
+			fmt.Sprintf("unterminated code block for %s in %s", current.Path, name),
+			nil,
+		)
+	}
+	if state == closed {
+		return emit(current)
+	}
+	return nil
+}
+
+// xml format
+//
+// <documents generator="baler" format="xml">
+// <document path="<path>"><![CDATA[<content>]]></document>
+// </documents>
+//
+// "]]>" inside the content is split across two CDATA sections,
+// so that the content can't end the document early.
+type xmlFormatter struct{}
+
+const xmlCDATAStart = "<![CDATA["
+const xmlCDATAEnd = "]]>"
+
+func (f *xmlFormatter) prologue() []byte {
+	return []byte("<documents generator=\"baler\" format=\"xml\">\n")
+}
+
+func (f *xmlFormatter) epilogue() []byte {
+	return []byte("</documents>\n")
+}
+
+// the tree is escaped, so that it can't contain a <document> element
+func (f *xmlFormatter) formatTree(tree []byte) []byte {
+	// unlike xml.EscapeText, new lines are kept readable
+	escaped := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(string(tree))
+	return []byte("<tree>\n" + escaped + "</tree>\n")
+}
+
+func (f *xmlFormatter) formatEntry(entry *bundleEntry) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("<document path=\"")
+	// EscapeText only fails on write errors, which bytes.Buffer doesn't return
+	_ = xml.EscapeText(&buffer, []byte(entry.Path))
+	buffer.WriteString("\">" + xmlCDATAStart)
+	buffer.Write(bytes.ReplaceAll(entry.Content, []byte(xmlCDATAEnd), []byte("]]"+xmlCDATAEnd+xmlCDATAStart+">")))
+	buffer.WriteString(xmlCDATAEnd + "</document>\n")
+	return buffer.Bytes()
+}
+
+type xmlParser struct {
+	config *BalerConfig
+}
+
+var xmlDocumentStart = regexp.MustCompile(`<document\s+path\s*=\s*"([^"]*)"\s*>`)
+
+func (p *xmlParser) parse(name string, reader io.Reader, emit func(entry *bundleEntry) *BalerError) *BalerError {
+	// documents can't be parsed line by line, so the whole file is
+	// read, up to the size limit of input files
+	data, err := io.ReadAll(io.LimitReader(reader, int64(p.config.MaxInputFileSize)+1))
+	if err != nil {
+		return NewIOError(fmt.Sprintf("unable to read file: %s", name), err)
+	}
+	if uint64(len(data)) > p.config.MaxInputFileSize {
+		return newScanError(name, bufio.ErrTooLong)
+	}
+
+	for len(data) > 0 {
+		match := xmlDocumentStart.FindSubmatchIndex(data)
+		if match == nil {
+			break
+		}
+		entry := &bundleEntry{
+			Path:    html.UnescapeString(string(data[match[2]:match[3]])),
+			Content: []byte{},
+		}
+		data = data[match[1]:]
+
+		end := bytes.Index(data, []byte("</document>"))
+		if end < 0 {
+			return NewValidationError(fmt.Sprintf("unterminated document for %s in %s", entry.Path, name), nil)
+		}
+		if trimmed := bytes.TrimLeft(data, " \t\r\n"); bytes.HasPrefix(trimmed, []byte(xmlCDATAStart)) {
+			// consecutive CDATA sections are joined
+			data = trimmed
+			for bytes.HasPrefix(data, []byte(xmlCDATAStart)) {
+				data = data[len(xmlCDATAStart):]
+				sectionEnd := bytes.Index(data, []byte(xmlCDATAEnd))
+				if sectionEnd < 0 {
+					return NewValidationError(fmt.Sprintf("unterminated CDATA section for %s in %s", entry.Path, name), nil)
+				}
+				entry.Content = append(entry.Content, data[:sectionEnd]...)
+				data = data[sectionEnd+len(xmlCDATAEnd):]
+			}
+			data = bytes.TrimLeft(data, " \t\r\n")
+			if !bytes.HasPrefix(data, []byte("</document>")) {
+				return NewValidationError(fmt.Sprintf("unexpected content after CDATA section for %s in %s", entry.Path, name), nil)
+			}
+			data = data[len("</document>"):]
+		} else {
+			// escaped text, e.g/ written by hand or by a model
+			entry.Content = []byte(html.UnescapeString(string(data[:end])))
+			data = data[end+len("</document>"):]
+		}
+		if balerErr := emit(entry); balerErr != nil {
+			return balerErr
+		}
+	}
+	return nil
+}
+
+// jsonl format
+//
+// one JSON object per file and per line, see jsonlRecord
+type jsonlFormatter struct{}
+
+type jsonlRecord struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Size    int    `json:"size"`
+	// octal permission bits, e.g/ "0644"
+	Mode     string `json:"mode"`
+	SHA256   string `json:"sha256"`
+	Language string `json:"language"`
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *jsonlFormatter) prologue() []byte {
+	return nil
+}
+
+func (f *jsonlFormatter) epilogue() []byte {
+	return nil
+}
+
+// records without a path are ignored while parsing
+func (f *jsonlFormatter) formatTree(tree []byte) []byte {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	// a struct of strings always encodes
+	_ = encoder.Encode(&struct {
+		Tree string `json:"tree"`
+	}{Tree: string(tree)})
+	return buffer.Bytes()
+}
+
+func (f *jsonlFormatter) formatEntry(entry *bundleEntry) []byte {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	// keep '<', '>' and '&' readable in source code
+	encoder.SetEscapeHTML(false)
+	// a struct of strings and ints always encodes
+	_ = encoder.Encode(&jsonlRecord{
+		Path:     entry.Path,
+		Content:  string(entry.Content),
+		Size:     len(entry.Content),
+		Mode:     fmt.Sprintf("%04o", entry.Mode.Perm()),
+		SHA256:   checksum(entry.Content),
+		Language: inferLanguage(entry.Path),
+	})
+	return buffer.Bytes()
+}
+
+type jsonlParser struct {
+	config *BalerConfig
+}
+
+func (p *jsonlParser) parse(name string, reader io.Reader, emit func(entry *bundleEntry) *BalerError) *BalerError {
+	decoder := json.NewDecoder(reader)
+	for index := 1; ; index++ {
+		var record jsonlRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return NewValidationError(fmt.Sprintf("invalid record %d in %s", index, name), err)
+		}
+		if record.Path == "" {
+			continue
+		}
+		entry := &bundleEntry{Path: record.Path, Content: []byte(record.Content)}
+		if record.Mode != "" {
+			mode, err := strconv.ParseUint(record.Mode, 8, 32)
+			if err != nil {
+				return NewValidationError(fmt.Sprintf("invalid mode of %s in %s", record.Path, name), err)
+			}
+			entry.Mode = fs.FileMode(mode).Perm()
+		}
+		if record.SHA256 != "" && record.SHA256 != checksum(entry.Content) {
+			p.config.Logger.Warn("Checksum mismatch, content was modified after convert", "path", record.Path, "output_file", name)
+		}
+		if balerErr := emit(entry); balerErr != nil {
+			return balerErr
+		}
+	}
+}
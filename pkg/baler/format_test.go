@@ -0,0 +1,254 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownFormat(t *testing.T) {
+	entries := []*bundleEntry{
+		{Path: "main.go", Content: []byte("package main\n\nfunc main() {}\n")},
+		{Path: "README.md", Content: []byte("# Title\n\n```go\nfmt.Println()\n```\n\n### not a file\n")},
+		{Path: "docs/ticks.md", Content: []byte("inline ```` ticks\n")},
+		{Path: "no_newline.txt", Content: []byte("last line")},
+		{Path: "crlf.txt", Content: []byte("a\r\nb\r\n")},
+		{Path: "blank_lines.txt", Content: []byte("a\n\n\n")},
+		{Path: "empty.txt", Content: []byte{}},
+	}
+	config := &BalerConfig{Format: FormatMarkdown, MaxInputFileSize: 1024 * 1024, Logger: &NoopLogger{}}
+	formatter, balerErr := newBundleFormatter(config)
+	if balerErr != nil {
+		t.Fatalf("Failed to create formatter: %v", balerErr)
+	}
+	var output bytes.Buffer
+	for _, entry := range entries {
+		output.Write(formatter.formatEntry(entry))
+	}
+
+	if !bytes.Contains(output.Bytes(), []byte("\n````markdown\n# Title")) {
+		t.Errorf("Expected a fence longer than the backtick runs in README.md:\n%s", output.String())
+	}
+	if !bytes.Contains(output.Bytes(), []byte("\n`````markdown\ninline")) {
+		t.Errorf("Expected a fence longer than the backtick runs in docs/ticks.md:\n%s", output.String())
+	}
+	if !bytes.Contains(output.Bytes(), []byte("### main.go\n\n```go\n")) {
+		t.Errorf("Expected a go code block for main.go:\n%s", output.String())
+	}
+
+	parser, balerErr := newBundleParser(config)
+	if balerErr != nil {
+		t.Fatalf("Failed to create parser: %v", balerErr)
+	}
+	var parsed []*bundleEntry
+	balerErr = parser.parse("output_0.txt", &output, func(entry *bundleEntry) *BalerError {
+		parsed = append(parsed, entry)
+		return nil
+	})
+	if balerErr != nil {
+		t.Fatalf("Failed to parse: %v", balerErr)
+	}
+	if len(parsed) != len(entries) {
+		t.Fatalf("Expected %d entries, got %d", len(entries), len(parsed))
+	}
+	for i, entry := range entries {
+		if parsed[i].Path != entry.Path {
+			t.Errorf("Expected path %s, got %s", entry.Path, parsed[i].Path)
+		}
+		if !bytes.Equal(parsed[i].Content, entry.Content) {
+			t.Errorf("Content mismatch for %s\nExpected: %q\nGot: %q", entry.Path, entry.Content, parsed[i].Content)
+		}
+	}
+
+	unterminated := bytes.NewBufferString("### main.go\n\n```go\npackage main\n")
+	balerErr = parser.parse("output_0.txt", unterminated, func(entry *bundleEntry) *BalerError { return nil })
+	if balerErr == nil || balerErr.Type != ErrorTypeValidation {
+		t.Errorf("Expected validation error for unterminated code block, got %v", balerErr)
+	}
+}
+
+func TestXMLFormat(t *testing.T) {
+	entries := []*bundleEntry{
+		{Path: "main.go", Content: []byte("package main\n\nfunc main() {}\n")},
+		{Path: "docs/breakout.xml", Content: []byte("</document>\n<document path=\"evil\"><![CDATA[x]]></document>\n")},
+		{Path: "a&b \"quoted\".txt", Content: []byte("nested ]]> end ]]]]> twice")},
+		{Path: "crlf.txt", Content: []byte("a\r\nb\r\n")},
+		{Path: "empty.txt", Content: []byte{}},
+	}
+	config := &BalerConfig{Format: FormatXML, MaxInputFileSize: 1024 * 1024, Logger: &NoopLogger{}}
+	formatter, balerErr := newBundleFormatter(config)
+	if balerErr != nil {
+		t.Fatalf("Failed to create formatter: %v", balerErr)
+	}
+	var output bytes.Buffer
+	output.Write(formatter.prologue())
+	for _, entry := range entries {
+		output.Write(formatter.formatEntry(entry))
+	}
+	output.Write(formatter.epilogue())
+
+	// auto detection picks the xml parser
+	parser, balerErr := newBundleParser(&BalerConfig{
+		Format:           FormatAuto,
+		FileDelimiter:    "// filename: ",
+		MaxInputFileSize: 1024 * 1024,
+		Logger:           &NoopLogger{},
+	})
+	if balerErr != nil {
+		t.Fatalf("Failed to create parser: %v", balerErr)
+	}
+	var parsed []*bundleEntry
+	balerErr = parser.parse("output_0.txt", &output, func(entry *bundleEntry) *BalerError {
+		parsed = append(parsed, entry)
+		return nil
+	})
+	if balerErr != nil {
+		t.Fatalf("Failed to parse: %v", balerErr)
+	}
+	if len(parsed) != len(entries) {
+		t.Fatalf("Expected %d entries, got %d", len(entries), len(parsed))
+	}
+	for i, entry := range entries {
+		if parsed[i].Path != entry.Path {
+			t.Errorf("Expected path %s, got %s", entry.Path, parsed[i].Path)
+		}
+		if !bytes.Equal(parsed[i].Content, entry.Content) {
+			t.Errorf("Content mismatch for %s\nExpected: %q\nGot: %q", entry.Path, entry.Content, parsed[i].Content)
+		}
+	}
+
+	// documents written without CDATA are unescaped
+	escaped := bytes.NewBufferString("<documents>\n<document path=\"a.go\">if a &lt; b &amp;&amp; c {}\n</document>\n</documents>\n")
+	balerErr = parser.parse("output_1.txt", escaped, func(entry *bundleEntry) *BalerError {
+		if string(entry.Content) != "if a < b && c {}\n" {
+			t.Errorf("Expected unescaped content, got %q", entry.Content)
+		}
+		return nil
+	})
+	if balerErr != nil {
+		t.Fatalf("Failed to parse escaped documents: %v", balerErr)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	config := &BalerConfig{FileDelimiter: "// filename: "}
+	tests := []struct {
+		name     string
+		head     string
+		expected OutputFormat
+	}{
+		{name: "Text", head: "\n// filename: main.go\npackage main\n", expected: FormatText},
+		{name: "Markdown", head: "\n### main.go\n\n```go\n", expected: FormatMarkdown},
+		{name: "XML", head: "<documents generator=\"baler\" format=\"xml\">\n", expected: FormatXML},
+		{name: "Unknown defaults to text", head: "hello\n### main.go\n", expected: FormatText},
+		{name: "Empty defaults to text", head: "", expected: FormatText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if format := detectFormat([]byte(tt.head), config); format != tt.expected {
+				t.Errorf("Expected format %s, got %s", tt.expected, format)
+			}
+		})
+	}
+}
+
+func TestMarkdownIntegration(t *testing.T) {
+	files := map[string]string{
+		"main.go":       "package main\n// filename: not a delimiter in markdown\n",
+		"lib/README.md": "```sh\nmake\n```",
+	}
+
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Format:            FormatMarkdown,
+		Logger:            &NoopLogger{},
+	}
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: config.MaxOutputFileSize,
+		FileDelimiter:    config.FileDelimiter,
+		Format:           FormatMarkdown,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	assertRoundTrip(t, files, config, unconvertConfig)
+}
+
+func TestJSONLIntegration(t *testing.T) {
+	sourceDir := newTestDir(t)
+	destDir := newTestDir(t)
+
+	files := map[string]string{
+		"main.go":    "package main\n\nfunc main() { println(\"<&>\") }\n",
+		"run.sh":     "#!/bin/sh\necho done",
+		"lib/a.txt":  strings.Repeat("a", 600),
+		"lib/b.txt":  strings.Repeat("b", 600),
+		"quotes.txt": "\"quoted\"\t\\ and \r\n",
+	}
+	writeTestTree(t, sourceDir, files)
+	if err := os.Chmod(filepath.Join(sourceDir, "run.sh"), 0755); err != nil {
+		t.Fatalf("Failed to change permissions: %v", err)
+	}
+
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 1500,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Format:            FormatJSONL,
+		Logger:            &NoopLogger{},
+	}
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	outputFiles, err := filepath.Glob(filepath.Join(destDir, "output_*.txt"))
+	if err != nil {
+		t.Fatalf("Failed to list output files: %v", err)
+	}
+	if len(outputFiles) < 2 {
+		t.Errorf("Expected output to roll over into several files, got %d", len(outputFiles))
+	}
+	for _, outputFile := range outputFiles {
+		content, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			var record jsonlRecord
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("Expected a JSON object per line, got %q: %v", line, err)
+			}
+			if record.SHA256 != checksum([]byte(record.Content)) || record.Size != len(record.Content) {
+				t.Errorf("Unexpected checksum or size for %s", record.Path)
+			}
+			if record.Path == "main.go" && record.Language != "go" {
+				t.Errorf("Expected language go for main.go, got %s", record.Language)
+			}
+		}
+	}
+
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: config.MaxOutputFileSize,
+		FileDelimiter:    config.FileDelimiter,
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	unconvertDir := unconvertTestTree(t, destDir, unconvertConfig)
+	assertTestTree(t, unconvertDir, files)
+	info, err := os.Stat(filepath.Join(unconvertDir, "run.sh"))
+	if err != nil {
+		t.Fatalf("Failed to stat run.sh: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Expected run.sh to keep mode 0755, got %o", info.Mode().Perm())
+	}
+}
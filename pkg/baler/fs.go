@@ -0,0 +1,176 @@
+package baler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// BundleWriter creates the output files of Convert, e.g/ in a directory with
+// NewDirBundleWriter, in a single stream with NewStreamBundleWriter, or in
+// memory
+type BundleWriter interface {
+	// Create opens a new output file, name is a file name without directories
+	Create(name string) (io.WriteCloser, error)
+}
+
+// dirBundleWriter creates output files in a directory, and fails when they
+// already exist
+type dirBundleWriter struct {
+	dir string
+}
+
+// NewDirBundleWriter returns a BundleWriter creating output files and the
+// manifest in dir
+func NewDirBundleWriter(dir string) BundleWriter {
+	return &dirBundleWriter{dir: dir}
+}
+
+func (w *dirBundleWriter) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+}
+
+// streamBundleWriter writes a single output file into a stream, which is
+// left open
+type streamBundleWriter struct {
+	writer io.Writer
+}
+
+// NewStreamBundleWriter returns a BundleWriter writing into writer, e.g/
+// os.Stdout. The stream isn't split by size or tokens, and has no manifest.
+func NewStreamBundleWriter(writer io.Writer) BundleWriter {
+	return &streamBundleWriter{writer: writer}
+}
+
+func (w *streamBundleWriter) Create(name string) (io.WriteCloser, error) {
+	return nopWriteCloser{w.writer}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// isStream reports whether sink writes a single stream without rollover
+func isStream(sink BundleWriter) bool {
+	_, ok := sink.(*streamBundleWriter)
+	return ok
+}
+
+// WritableFS is a file system UnConvert writes files into, e.g/ a directory
+// with NewDirFS. Names are slash separated paths, as in fs.FS.
+type WritableFS interface {
+	fs.FS
+	MkdirAll(name string, perm fs.FileMode) error
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// dirFS is a directory on disk. Unlike other file systems, files are
+// written into it atomically, and paths going through symbolic links
+// outside of it are detected.
+type dirFS struct {
+	dir  string
+	fsys fs.FS
+}
+
+// NewDirFS returns the file system of the directory dir, like os.DirFS,
+// which can also be written into
+func NewDirFS(dir string) WritableFS {
+	return &dirFS{dir: dir, fsys: os.DirFS(dir)}
+}
+
+func (d *dirFS) Open(name string) (fs.File, error) {
+	file, err := d.fsys.Open(name)
+	return file, d.diskError(err)
+}
+
+func (d *dirFS) ReadFile(name string) ([]byte, error) {
+	content, err := fs.ReadFile(d.fsys, name)
+	return content, d.diskError(err)
+}
+
+func (d *dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(d.fsys, name)
+	return entries, d.diskError(err)
+}
+
+func (d *dirFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fs.Stat(d.fsys, name)
+	return info, d.diskError(err)
+}
+
+// diskError replaces the names in errors of os.DirFS with paths on disk
+func (d *dirFS) diskError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = filepath.Join(d.dir, filepath.FromSlash(pathErr.Path))
+	}
+	return err
+}
+
+// join returns the path on disk of name, which is a valid fs.FS path
+func (d *dirFS) join(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name)), nil
+}
+
+func (d *dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	fullPath, err := d.join("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(fullPath, perm)
+}
+
+func (d *dirFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	fullPath, err := d.join("write", name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fullPath, data, perm)
+}
+
+// displayPath returns name as shown in messages, the path on disk for
+// directories opened with NewDirFS
+func displayPath(fsys fs.FS, name string) string {
+	if d, ok := fsys.(*dirFS); ok {
+		return filepath.Join(d.dir, filepath.FromSlash(name))
+	}
+	return name
+}
+
+// rootName returns the name of the root of fsys in the directory tree
+func rootName(fsys fs.FS) string {
+	if d, ok := fsys.(*dirFS); ok {
+		if absDir, err := filepath.Abs(d.dir); err == nil {
+			return filepath.Base(absDir)
+		}
+	}
+	return "."
+}
+
+// fsName returns the path of an entry read from a bundle in a file system,
+// which can't go outside of it once checked by unsafePathReason, e.g/
+// "./a//b.txt" is "a/b.txt"
+func fsName(entryPath string) string {
+	return path.Clean(entryPath)
+}
+
+// checkDirectory fails when the root of fsys isn't a directory
+func checkDirectory(fsys fs.FS, description string) *BalerError {
+	info, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return NewValidationError(fmt.Sprintf("%s doesn't exist: %s", description, displayPath(fsys, ".")), err)
+	}
+	if !info.IsDir() {
+		return NewValidationError(fmt.Sprintf("%s isn't a directory: %s", description, displayPath(fsys, ".")), nil)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// memoryBundle is a BundleWriter keeping output files in memory
+type memoryBundle fstest.MapFS
+
+func (b memoryBundle) Create(name string) (io.WriteCloser, error) {
+	return &memoryFile{bundle: b, name: name}, nil
+}
+
+type memoryFile struct {
+	bytes.Buffer
+	bundle memoryBundle
+	name   string
+}
+
+func (f *memoryFile) Close() error {
+	f.bundle[f.name] = &fstest.MapFile{Data: f.Bytes(), Mode: 0644}
+	return nil
+}
+
+// memoryFS is a WritableFS in memory
+type memoryFS struct {
+	fstest.MapFS
+}
+
+func (m memoryFS) MkdirAll(name string, perm fs.FileMode) error {
+	if name != "." {
+		m.MapFS[name] = &fstest.MapFile{Mode: fs.ModeDir | perm}
+	}
+	return nil
+}
+
+func (m memoryFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func TestConvertMemory(t *testing.T) {
+	source := fstest.MapFS{
+		"main.go":      {Data: []byte("package main\n")},
+		"lib/a.txt":    {Data: []byte(strings.Repeat("a\n", 200))},
+		"lib/b/c.txt":  {Data: []byte("c\n")},
+		".gitignore":   {Data: []byte("*.log\n")},
+		"debug.log":    {Data: []byte("ignored\n")},
+		"binary.dat":   {Data: []byte{0xff, 0xfe, 0x00}},
+		"empty/.keep":  {Data: []byte{}},
+		"skipped.json": {Data: []byte(strings.Repeat("x", 2048))},
+	}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 1000,
+		MaxOutputFileSize: 512,
+		ExclusionPatterns: &[]string{},
+		IgnoreFileNames:   &[]string{".gitignore"},
+		FileDelimiter:     "// filename: ",
+		Format:            FormatJSONL,
+		Tree:              true,
+		Logger:            &NoopLogger{},
+	}
+	bundle := memoryBundle{}
+	if _, balerErr := Convert(context.Background(), source, bundle, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	manifest, balerErr := ReadManifest(fstest.MapFS(bundle))
+	if balerErr != nil || manifest == nil {
+		t.Fatalf("Expected a manifest, got %v, %v", manifest, balerErr)
+	}
+	if len(manifest.OutputFiles) < 2 || len(bundle) != len(manifest.OutputFiles)+1 {
+		t.Errorf("Expected several output files and the manifest, got %d files for %v", len(bundle), manifest.OutputFiles)
+	}
+	if tree := string(bundle["output_0.txt"].Data); !strings.Contains(tree, "skipped.json (skipped: exceeds --max-input-file-size)") {
+		t.Errorf("Expected the tree in the first output file, got %q", tree)
+	}
+
+	// existing files are overwritten, others are kept
+	destination := memoryFS{fstest.MapFS{
+		"main.go":  {Data: []byte("package old\n"), Mode: 0600},
+		"other.go": {Data: []byte("package other\n")},
+	}}
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	if balerErr := UnConvert(context.Background(), NewFSBundleReader(fstest.MapFS(bundle)), destination, unconvertConfig); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	expected := map[string]string{
+		"main.go":     "package main\n",
+		"lib/a.txt":   strings.Repeat("a\n", 200),
+		"lib/b/c.txt": "c\n",
+		".gitignore":  "*.log\n",
+		"empty/.keep": "",
+		"other.go":    "package other\n",
+	}
+	for path, content := range expected {
+		file, ok := destination.MapFS[path]
+		if !ok || string(file.Data) != content {
+			t.Errorf("Expected %q in %s, got %v", content, path, file)
+		}
+	}
+	for _, path := range []string{"debug.log", "binary.dat", "skipped.json"} {
+		if _, ok := destination.MapFS[path]; ok {
+			t.Errorf("Expected %s not to be converted", path)
+		}
+	}
+}
+
+func TestUnConvertMemoryUnsafePaths(t *testing.T) {
+	stream := "// filename: safe.txt\nsafe\n\n// filename: ../escape.txt\nescape\n\n// filename: ./dot/./file.txt\ndot\n\n"
+	config := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatText,
+		SkipUnsafePaths:  true,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	destination := memoryFS{fstest.MapFS{}}
+	balerErr := UnConvert(context.Background(), NewStreamBundleReader(strings.NewReader(stream)), destination, config)
+	if balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	if len(destination.MapFS) != 3 || destination.MapFS["safe.txt"] == nil || destination.MapFS["dot/file.txt"] == nil {
+		t.Errorf("Expected safe.txt and dot/file.txt only, got %v", destination.MapFS)
+	}
+}
+
+func TestConvertCanceled(t *testing.T) {
+	source := fstest.MapFS{"main.go": {Data: []byte("package main\n")}}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 1000,
+		MaxOutputFileSize: 1024,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, balerErr := Convert(ctx, source, memoryBundle{}, config)
+	if balerErr == nil || !errors.Is(balerErr, context.Canceled) {
+		t.Errorf("Expected convert to be canceled, got %v", balerErr)
+	}
+}
@@ -0,0 +1,152 @@
+package baler
+
+import (
+	"path"
+	"strings"
+)
+
+// matchSegments matches a pattern split on '/' against a path split on '/'.
+// A "**" segment matches zero or more path segments, a trailing "**"
+// matches one or more. Other segments follow path.Match syntax.
+func matchSegments(patternSegments []string, pathSegments []string) (bool, error) {
+	for len(patternSegments) > 0 {
+		if patternSegments[0] == "**" {
+			rest := patternSegments[1:]
+			if len(rest) == 0 {
+				return len(pathSegments) > 0, nil
+			}
+			for i := 0; i <= len(pathSegments); i++ {
+				matches, err := matchSegments(rest, pathSegments[i:])
+				if err != nil || matches {
+					return matches, err
+				}
+			}
+			return false, nil
+		}
+		if len(pathSegments) == 0 {
+			// still check the rest of the pattern for syntax errors
+			for _, segment := range patternSegments {
+				if _, err := path.Match(segment, ""); err != nil {
+					return false, err
+				}
+			}
+			return false, nil
+		}
+		matches, err := path.Match(patternSegments[0], pathSegments[0])
+		if err != nil || !matches {
+			return false, err
+		}
+		patternSegments = patternSegments[1:]
+		pathSegments = pathSegments[1:]
+	}
+	return len(pathSegments) == 0, nil
+}
+
+// expandBraces expands brace alternations like "*.{js,ts}" into
+// "*.js" and "*.ts". Nested braces are supported.
+func expandBraces(pattern string) ([]string, error) {
+	start := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, path.ErrBadPattern
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			prefix, body, suffix := pattern[:start], pattern[start+1:i], pattern[i+1:]
+			var expanded []string
+			for _, alternative := range splitBraceBody(body) {
+				alternatives, err := expandBraces(prefix + alternative + suffix)
+				if err != nil {
+					return nil, err
+				}
+				expanded = append(expanded, alternatives...)
+			}
+			return expanded, nil
+		}
+	}
+	if depth != 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+// splitBraceBody splits the inside of a brace on top level commas
+func splitBraceBody(body string) []string {
+	var alternatives []string
+	depth := 0
+	last := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, body[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(alternatives, body[last:])
+}
+
+// matchGlob reports whether name matches the glob pattern.
+//
+// On top of path.Match syntax ('*', '?', '[a-z]', '\\'), the pattern
+// supports '**' as a complete path segment matching any number of
+// directories, and brace alternation like '{a,b}'.
+func matchGlob(pattern string, name string) (bool, error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return false, err
+	}
+	pathSegments := strings.Split(name, "/")
+	for _, expanded := range patterns {
+		matches, err := matchSegments(strings.Split(expanded, "/"), pathSegments)
+		if err != nil || matches {
+			return matches, err
+		}
+	}
+	return false, nil
+}
+
+// matchGlobDirectory reports whether pattern matches every path inside
+// the directory dir, e.g/ "node_modules/*" or "**/vendor/**" for "a/vendor".
+// Such directories can be skipped without walking them.
+func matchGlobDirectory(pattern string, dir string) (bool, error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, expanded := range patterns {
+		var prefix string
+		switch {
+		case strings.HasSuffix(expanded, "/**"):
+			prefix = strings.TrimSuffix(expanded, "/**")
+		case strings.HasSuffix(expanded, "/*"):
+			prefix = strings.TrimSuffix(expanded, "/*")
+		default:
+			continue
+		}
+		matches, err := matchSegments(strings.Split(prefix, "/"), strings.Split(dir, "/"))
+		if err != nil || matches {
+			return matches, err
+		}
+	}
+	return false, nil
+}
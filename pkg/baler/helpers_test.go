@@ -0,0 +1,91 @@
+package baler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupTestDir(t *testing.T) (string, func()) {
+	dir, err := os.MkdirTemp("", "baler-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	return dir, cleanup
+}
+
+func createTestFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	return path
+}
+
+// newTestDir returns a directory removed at the end of the test
+func newTestDir(t *testing.T) string {
+	dir, cleanup := setupTestDir(t)
+	t.Cleanup(cleanup)
+	return dir
+}
+
+// writeTestTree writes files, by slash separated path, into dir
+func writeTestTree(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		createTestFile(t, filepath.Dir(fullPath), filepath.Base(fullPath), content)
+	}
+}
+
+// assertTestTree checks that every file of files has its content in dir
+func assertTestTree(t *testing.T, dir string, files map[string]string) {
+	for path, expectedContent := range files {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Errorf("Failed to read unconverted file %s: %v", path, err)
+		} else if string(content) != expectedContent {
+			t.Errorf("Content mismatch for %s\nExpected: %q\nGot: %q", path, expectedContent, content)
+		}
+	}
+}
+
+// convertTestTree writes files into a source directory, converts it with
+// config, and returns the directory of the output files
+func convertTestTree(t *testing.T, files map[string]string, config *BalerConfig) string {
+	sourceDir := newTestDir(t)
+	writeTestTree(t, sourceDir, files)
+	outputDir := newTestDir(t)
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, outputDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	return outputDir
+}
+
+// unconvertTestTree unconverts the output files in outputDir with config,
+// and returns the directory of the restored files
+func unconvertTestTree(t *testing.T, outputDir string, config *BalerConfig) string {
+	unconvertDir := newTestDir(t)
+	if balerErr := UnConvertDir(context.Background(), outputDir, unconvertDir, config); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	return unconvertDir
+}
+
+// assertRoundTrip converts files with config, unconverts them with
+// unconvertConfig, and checks that every file is restored. It returns the
+// directory of the output files.
+func assertRoundTrip(t *testing.T, files map[string]string, config *BalerConfig, unconvertConfig *BalerConfig) string {
+	outputDir := convertTestTree(t, files, config)
+	assertTestTree(t, unconvertTestTree(t, outputDir, unconvertConfig), files)
+	return outputDir
+}
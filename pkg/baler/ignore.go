@@ -0,0 +1,156 @@
+package baler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ignoreRule is a single pattern read from a .gitignore style file
+type ignoreRule struct {
+	// path of the ignore file the rule comes from, relative to the source directory
+	Source string
+	// pattern as written in the ignore file
+	Pattern string
+	// directory containing the ignore file, relative to the source directory
+	// "" for the source directory itself
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreMatcher holds the rules applicable to a directory, ordered from
+// the outermost ignore file to the innermost one. The last matching rule wins.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+func parseIgnoreFile(content string, source string, base string) ([]ignoreRule, *BalerError) {
+	var rules []ignoreRule
+	for lineNumber, line := range strings.Split(content, "\n") {
+		line = trimTrailingSpaces(strings.TrimRight(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{Source: source, Pattern: line, base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// a pattern with a slash at the beginning or in the middle is
+		// relative to the directory of the ignore file, otherwise it
+		// matches at any level below it
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		if !anchored {
+			rule.segments = append([]string{"**"}, rule.segments...)
+		}
+		for _, segment := range rule.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, NewValidationError(
+					fmt.Sprintf("invalid pattern in %s at line %d: %s", source, lineNumber+1, rule.Pattern),
+					err,
+				)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// gitExcludeFile holds the rules of a repository which aren't shared
+const gitExcludeFile = ".git/info/exclude"
+
+// usesGitIgnore reports whether .gitignore files are honored, along with
+// the rest of the rules of git
+func usesGitIgnore(fileNames *[]string) bool {
+	return fileNames != nil && slices.Contains(*fileNames, ".gitignore")
+}
+
+// loadIgnoreFiles reads the ignore files named in fileNames from the
+// directory relDir of fsys, "" for its root. With .gitignore, the root
+// also reads .git/info/exclude, before the other files like git does.
+func loadIgnoreFiles(fsys fs.FS, relDir string, fileNames *[]string) ([]ignoreRule, *BalerError) {
+	var rules []ignoreRule
+	if fileNames == nil {
+		return rules, nil
+	}
+	names := *fileNames
+	if relDir == "" && usesGitIgnore(fileNames) {
+		names = append([]string{gitExcludeFile}, names...)
+	}
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, path.Join(relDir, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, NewIOError(fmt.Sprintf("unable to read ignore file: %s", displayPath(fsys, path.Join(relDir, name))), err)
+		}
+		fileRules, balerErr := parseIgnoreFile(string(content), path.Join(relDir, name), relDir)
+		if balerErr != nil {
+			return nil, balerErr
+		}
+		rules = append(rules, fileRules...)
+	}
+	return rules, nil
+}
+
+// withRules returns a matcher with rules appended, leaving m untouched
+func (m *ignoreMatcher) withRules(rules []ignoreRule) *ignoreMatcher {
+	if len(rules) == 0 {
+		return m
+	}
+	combined := make([]ignoreRule, 0, len(m.rules)+len(rules))
+	combined = append(combined, m.rules...)
+	combined = append(combined, rules...)
+	return &ignoreMatcher{rules: combined}
+}
+
+// match reports whether relativePath (slash separated, relative to the
+// source directory) is ignored, along with the rule that decided it
+func (m *ignoreMatcher) match(relativePath string, isDir bool) (bool, *ignoreRule) {
+	var matchedRule *ignoreRule
+	for i := range m.rules {
+		rule := &m.rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rulePath := relativePath
+		if rule.base != "" {
+			if !strings.HasPrefix(rulePath, rule.base+"/") {
+				continue
+			}
+			rulePath = strings.TrimPrefix(rulePath, rule.base+"/")
+		}
+		// patterns are validated while parsing
+		if matches, _ := matchSegments(rule.segments, strings.Split(rulePath, "/")); matches {
+			matchedRule = rule
+		}
+	}
+	if matchedRule == nil {
+		return false, nil
+	}
+	return !matchedRule.negate, matchedRule
+}
@@ -0,0 +1,122 @@
+package baler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	rootRules, err := parseIgnoreFile(
+		"# comment\n*.log\n!keep.log\nbuild/\n/dist\ndocs/*.tmp\n",
+		".gitignore",
+		"",
+	)
+	if err != nil {
+		t.Fatalf("Failed to parse root ignore file: %v", err)
+	}
+	nestedRules, err := parseIgnoreFile("*.gen.go\n!important.log\n", "lib/.balerignore", "lib")
+	if err != nil {
+		t.Fatalf("Failed to parse nested ignore file: %v", err)
+	}
+	matcher := (&ignoreMatcher{}).withRules(rootRules).withRules(nestedRules)
+
+	tests := []struct {
+		name         string
+		path         string
+		isDir        bool
+		expectIgnore bool
+	}{
+		{name: "Unanchored pattern at root", path: "debug.log", expectIgnore: true},
+		{name: "Unanchored pattern nested", path: "a/b/debug.log", expectIgnore: true},
+		{name: "Negated pattern", path: "a/keep.log", expectIgnore: false},
+		{name: "Directory only pattern on directory", path: "src/build", isDir: true, expectIgnore: true},
+		{name: "Directory only pattern on file", path: "src/build", isDir: false, expectIgnore: false},
+		{name: "Anchored pattern at root", path: "dist", isDir: true, expectIgnore: true},
+		{name: "Anchored pattern nested", path: "web/dist", isDir: true, expectIgnore: false},
+		{name: "Pattern with middle slash", path: "docs/a.tmp", expectIgnore: true},
+		{name: "Pattern with middle slash nested", path: "x/docs/a.tmp", expectIgnore: false},
+		{name: "Nested ignore file applies below it", path: "lib/x/types.gen.go", expectIgnore: true},
+		{name: "Nested ignore file doesn't apply outside", path: "types.gen.go", expectIgnore: false},
+		{name: "Nested negation overrides parent", path: "lib/important.log", expectIgnore: false},
+		{name: "Regular file", path: "main.go", expectIgnore: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ignore, _ := matcher.match(tt.path, tt.isDir)
+			if ignore != tt.expectIgnore {
+				t.Errorf("Expected ignore=%v but got %v", tt.expectIgnore, ignore)
+			}
+		})
+	}
+
+	if _, err := parseIgnoreFile("[invalid\n", ".gitignore", ""); err == nil {
+		t.Error("Expected error for invalid pattern but got none")
+	}
+}
+
+func TestConvertWithIgnoreFiles(t *testing.T) {
+	sourceDir := newTestDir(t)
+	destDir := newTestDir(t)
+
+	files := map[string]string{
+		".gitignore":         "*.log\nbuild/\n",
+		"main.go":            "package main\n",
+		"debug.log":          "log\n",
+		"build/out.go":       "package build\n",
+		"lib/.balerignore":   "*.gen.go\n!keep.log\n",
+		"lib/lib.go":         "package lib\n",
+		"lib/types.gen.go":   "package lib\n",
+		"lib/keep.log":       "keep\n",
+		"other/types.gen.go": "package other\n",
+		".git/HEAD":          "ref: refs/heads/main\n",
+		".git/info/exclude":  "local.txt\n",
+		"local.txt":          "not shared\n",
+		"lib/.git/config":    "[core]\n",
+	}
+	writeTestTree(t, sourceDir, files)
+
+	logger := &mockLogger{}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		IgnoreFileNames:   &[]string{".gitignore", ".balerignore"},
+		FileDelimiter:     "// filename: ",
+		Logger:            logger,
+		Verbose:           true,
+	}
+	processedFiles, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+
+	processed := map[string]bool{}
+	for _, file := range *processedFiles {
+		processed[filepath.ToSlash(file)] = true
+	}
+	for _, expected := range []string{"main.go", "lib/lib.go", "lib/keep.log", "other/types.gen.go", ".gitignore"} {
+		if !processed[expected] {
+			t.Errorf("Expected %s to be processed", expected)
+		}
+	}
+	for _, unexpected := range []string{
+		"debug.log", "build", "build/out.go", "lib/types.gen.go", ".git", ".git/HEAD", "local.txt", "lib/.git", "lib/.git/config",
+	} {
+		if processed[unexpected] {
+			t.Errorf("Expected %s to be ignored", unexpected)
+		}
+	}
+
+	foundSkipMessage := false
+	for _, record := range logger.infoMessages {
+		if record.attrs["reason"] == SkipIgnored && record.attrs["ignore_file"] == "lib/.balerignore" {
+			foundSkipMessage = true
+		}
+	}
+	if !foundSkipMessage {
+		t.Error("Expected verbose message for file ignored by lib/.balerignore")
+	}
+}
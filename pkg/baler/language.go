@@ -0,0 +1,83 @@
+package baler
+
+import (
+	"path"
+	"strings"
+)
+
+// languageByExtension maps file extensions to the language names
+// commonly used for syntax highlighting in Markdown code blocks
+var languageByExtension = map[string]string{
+	".bash":    "bash",
+	".c":       "c",
+	".cc":      "cpp",
+	".cfg":     "ini",
+	".clj":     "clojure",
+	".cpp":     "cpp",
+	".cs":      "csharp",
+	".css":     "css",
+	".dart":    "dart",
+	".ex":      "elixir",
+	".exs":     "elixir",
+	".go":      "go",
+	".gradle":  "groovy",
+	".graphql": "graphql",
+	".h":       "c",
+	".hpp":     "cpp",
+	".hs":      "haskell",
+	".html":    "html",
+	".ini":     "ini",
+	".java":    "java",
+	".js":      "javascript",
+	".json":    "json",
+	".jsx":     "jsx",
+	".kt":      "kotlin",
+	".lua":     "lua",
+	".md":      "markdown",
+	".mjs":     "javascript",
+	".php":     "php",
+	".pl":      "perl",
+	".proto":   "protobuf",
+	".ps1":     "powershell",
+	".py":      "python",
+	".r":       "r",
+	".rb":      "ruby",
+	".rs":      "rust",
+	".scala":   "scala",
+	".scss":    "scss",
+	".sh":      "bash",
+	".sql":     "sql",
+	".svelte":  "svelte",
+	".swift":   "swift",
+	".tf":      "hcl",
+	".toml":    "toml",
+	".ts":      "typescript",
+	".tsx":     "tsx",
+	".txt":     "text",
+	".vue":     "vue",
+	".xml":     "xml",
+	".yaml":    "yaml",
+	".yml":     "yaml",
+	".zig":     "zig",
+	".zsh":     "bash",
+}
+
+// languageByFileName maps well known file names without
+// a meaningful extension to their language
+var languageByFileName = map[string]string{
+	"CMakeLists.txt": "cmake",
+	"Dockerfile":     "dockerfile",
+	"Gemfile":        "ruby",
+	"Makefile":       "makefile",
+	"go.mod":         "go",
+	"go.sum":         "text",
+}
+
+// inferLanguage returns the language of a file from its name, or ""
+func inferLanguage(relativePath string) string {
+	name := path.Base(relativePath)
+	if language, ok := languageByFileName[name]; ok {
+		return language
+	}
+	return languageByExtension[strings.ToLower(path.Ext(name))]
+}
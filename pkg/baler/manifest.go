@@ -0,0 +1,188 @@
+package baler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"time"
+)
+
+// Version of baler, recorded in manifests
+const Version = "0.0.1-b0"
+
+// ManifestFileName is written by Convert next to the output files
+const ManifestFileName = "baler.manifest.json"
+
+// Manifest describes the output files of baler convert
+type Manifest struct {
+	Version string         `json:"version"`
+	Config  ManifestConfig `json:"config"`
+	// names of the output files, relative to the manifest
+	OutputFiles []string       `json:"output_files"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// ManifestConfig is the part of BalerConfig which shaped the output files
+type ManifestConfig struct {
+	Format             OutputFormat `json:"format"`
+	Delimiter          string       `json:"delimiter,omitempty"`
+	MaxInputFileLines  uint64       `json:"max_input_file_lines"`
+	MaxInputFileSize   uint64       `json:"max_input_file_size"`
+	MaxOutputFileSize  uint64       `json:"max_output_file_size"`
+	MaxInputFileTokens uint64       `json:"max_input_file_tokens,omitempty"`
+	MaxOutputTokens    uint64       `json:"max_output_tokens,omitempty"`
+	Tokenizer          string       `json:"tokenizer,omitempty"`
+	ExclusionPatterns  []string     `json:"exclusion_patterns"`
+	IncludePatterns    []string     `json:"include_patterns"`
+	IgnoreFileNames    []string     `json:"ignore_file_names"`
+	Order              FileOrder    `json:"order,omitempty"`
+	PriorityPatterns   []string     `json:"priority_patterns,omitempty"`
+	Tree               bool         `json:"tree,omitempty"`
+}
+
+// ManifestFile locates a converted file in the output files
+type ManifestFile struct {
+	// slash separated path relative to the converted directory
+	Path       string `json:"path"`
+	OutputFile string `json:"output_file"`
+	// byte offset and 1 based line of the entry in the output file,
+	// including the delimiter, heading or element around the content
+	Offset int64 `json:"offset"`
+	Line   int   `json:"line"`
+	// bytes and lines taken by the entry in the output file
+	Length  int64     `json:"length"`
+	Lines   int       `json:"lines"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+}
+
+func newManifest(config *BalerConfig, delimiter string) *Manifest {
+	manifestConfig := ManifestConfig{
+		Format:             config.Format,
+		MaxInputFileLines:  config.MaxInputFileLines,
+		MaxInputFileSize:   config.MaxInputFileSize,
+		MaxOutputFileSize:  config.MaxOutputFileSize,
+		MaxInputFileTokens: config.MaxInputFileTokens,
+		MaxOutputTokens:    config.MaxOutputTokens,
+		ExclusionPatterns:  []string{},
+		IncludePatterns:    []string{},
+		IgnoreFileNames:    []string{},
+		Order:              config.Order,
+		Tree:               config.Tree,
+	}
+	if manifestConfig.Format == "" {
+		manifestConfig.Format = FormatText
+	}
+	if manifestConfig.Order == "" {
+		manifestConfig.Order = OrderPath
+	}
+	if manifestConfig.Format == FormatText {
+		manifestConfig.Delimiter = delimiter
+	}
+	if config.Tokenizer != nil {
+		manifestConfig.Tokenizer = config.Tokenizer.Name()
+	}
+	if config.ExclusionPatterns != nil {
+		manifestConfig.ExclusionPatterns = append(manifestConfig.ExclusionPatterns, *config.ExclusionPatterns...)
+	}
+	if config.IncludePatterns != nil {
+		manifestConfig.IncludePatterns = append(manifestConfig.IncludePatterns, *config.IncludePatterns...)
+	}
+	if config.IgnoreFileNames != nil {
+		manifestConfig.IgnoreFileNames = append(manifestConfig.IgnoreFileNames, *config.IgnoreFileNames...)
+	}
+	if config.PriorityPatterns != nil {
+		manifestConfig.PriorityPatterns = append(manifestConfig.PriorityPatterns, *config.PriorityPatterns...)
+	}
+	return &Manifest{
+		Version:     Version,
+		Config:      manifestConfig,
+		OutputFiles: []string{},
+		Files:       []ManifestFile{},
+	}
+}
+
+// addOutputFile records an output file once it's created, including when
+// it only contains the directory tree
+func (m *Manifest) addOutputFile(name string) {
+	if !slices.Contains(m.OutputFiles, name) {
+		m.OutputFiles = append(m.OutputFiles, name)
+	}
+}
+
+// addFile records a file, and its output file if it's new
+func (m *Manifest) addFile(file ManifestFile) {
+	m.addOutputFile(file.OutputFile)
+	m.Files = append(m.Files, file)
+}
+
+// ReadManifest reads the manifest in the root of fsys, the output files of
+// baler convert, it returns nil without an error when there is no manifest
+func ReadManifest(fsys fs.FS) (*Manifest, *BalerError) {
+	manifestPath := displayPath(fsys, ManifestFileName)
+	content, err := fs.ReadFile(fsys, ManifestFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, NewIOError(fmt.Sprintf("unable to read manifest: %s", manifestPath), err)
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, NewValidationError(fmt.Sprintf("invalid manifest: %s", manifestPath), err)
+	}
+	return manifest, nil
+}
+
+func writeManifest(sink BundleWriter, manifest *Manifest) *BalerError {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return NewInternalError("unable to encode manifest", err)
+	}
+	file, err := sink.Create(ManifestFileName)
+	if err != nil {
+		return NewIOError(fmt.Sprintf("unable to write manifest: %s", ManifestFileName), err)
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return NewIOError(fmt.Sprintf("unable to write manifest: %s", ManifestFileName), err)
+	}
+	if err := file.Close(); err != nil {
+		return NewIOError(fmt.Sprintf("unable to write manifest: %s", ManifestFileName), err)
+	}
+	return nil
+}
+
+// convertConfig returns a copy of config using the rules which selected
+// the files of the output files, e.g/ exclusions and limits
+func (m *Manifest) convertConfig(config *BalerConfig) *BalerConfig {
+	manifestConfig := *config
+	manifestConfig.MaxInputFileLines = m.Config.MaxInputFileLines
+	manifestConfig.MaxInputFileSize = m.Config.MaxInputFileSize
+	manifestConfig.MaxOutputFileSize = m.Config.MaxOutputFileSize
+	manifestConfig.MaxInputFileTokens = m.Config.MaxInputFileTokens
+	manifestConfig.MaxOutputTokens = m.Config.MaxOutputTokens
+	manifestConfig.ExclusionPatterns = &m.Config.ExclusionPatterns
+	manifestConfig.IncludePatterns = &m.Config.IncludePatterns
+	manifestConfig.IgnoreFileNames = &m.Config.IgnoreFileNames
+	manifestConfig.Tokenizer = nil
+	switch {
+	case m.Config.Tokenizer == "":
+	case config.Tokenizer != nil && config.Tokenizer.Name() == m.Config.Tokenizer:
+		manifestConfig.Tokenizer = config.Tokenizer
+	default:
+		tokenizer, balerErr := NewTokenizer(m.Config.Tokenizer)
+		if balerErr == nil {
+			manifestConfig.Tokenizer = tokenizer
+		} else {
+			// e.g/ a vocabulary loaded from a file, which isn't recorded
+			config.Logger.Warn("Unknown tokenizer in manifest, token limits are not applied", "tokenizer", m.Config.Tokenizer)
+			manifestConfig.MaxInputFileTokens = 0
+			manifestConfig.MaxOutputTokens = 0
+		}
+	}
+	return &manifestConfig
+}
@@ -0,0 +1,76 @@
+package baler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	files := map[string]string{
+		"main.go":     "package main\n\nfunc main() {}\n",
+		"lib/util.go": "package lib",
+		"README.md":   strings.Repeat("docs\n", 20),
+	}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 120,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "## file: ",
+		Logger:            &NoopLogger{},
+	}
+	destDir := convertTestTree(t, files, config)
+	manifest, balerErr := ReadManifest(NewDirFS(destDir))
+	if balerErr != nil || manifest == nil {
+		t.Fatalf("Expected a manifest, got %v", balerErr)
+	}
+	if manifest.Version != Version || manifest.Config.Format != FormatText || manifest.Config.Delimiter != "## file: " {
+		t.Errorf("Unexpected manifest header: %+v", manifest)
+	}
+	if len(manifest.Files) != len(files) {
+		t.Fatalf("Expected %d files in manifest, got %d", len(files), len(manifest.Files))
+	}
+	if len(manifest.OutputFiles) < 2 {
+		t.Errorf("Expected several output files, got %v", manifest.OutputFiles)
+	}
+
+	formatter := &textFormatter{delimiter: config.FileDelimiter}
+	for _, file := range manifest.Files {
+		content, ok := files[file.Path]
+		if !ok {
+			t.Fatalf("Unexpected file in manifest: %s", file.Path)
+		}
+		if file.Size != int64(len(content)) || file.SHA256 != checksum([]byte(content)) || file.Mode != "0644" {
+			t.Errorf("Unexpected size, checksum or mode for %s: %+v", file.Path, file)
+		}
+		output, err := os.ReadFile(filepath.Join(destDir, file.OutputFile))
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		// the entry is found at its offset and line
+		expected := string(formatter.formatEntry(&bundleEntry{Path: file.Path, Content: []byte(content)}))
+		if entry := string(output[file.Offset : file.Offset+file.Length]); entry != expected {
+			t.Errorf("Expected entry %q at offset %d, got %q", expected, file.Offset, entry)
+		}
+		lines := strings.SplitAfter(string(output), "\n")
+		if entry := strings.Join(lines[file.Line-1:file.Line-1+file.Lines], ""); entry != expected {
+			t.Errorf("Expected entry %q at line %d, got %q", expected, file.Line, entry)
+		}
+	}
+
+	// the delimiter is taken from the manifest
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	unconvertDir := unconvertTestTree(t, destDir, unconvertConfig)
+	assertTestTree(t, unconvertDir, files)
+	if _, err := os.Stat(filepath.Join(unconvertDir, ManifestFileName)); err == nil {
+		t.Error("Expected the manifest not to be unconverted")
+	}
+}
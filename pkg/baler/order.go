@@ -0,0 +1,115 @@
+package baler
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileOrder is the order of the files in the output files of convert
+type FileOrder string
+
+const (
+	// lexical by slash separated path
+	OrderPath FileOrder = "path"
+	// files of shallower directories first, then by path
+	OrderBreadthFirst FileOrder = "breadth-first"
+	// smaller files first, then by path
+	OrderSize FileOrder = "size"
+	// most recently modified files first, then by path
+	OrderMtime FileOrder = "mtime"
+)
+
+// ParseFileOrder validates an order name, "" defaults to OrderPath
+func ParseFileOrder(name string) (FileOrder, *BalerError) {
+	switch FileOrder(name) {
+	case "", OrderPath:
+		return OrderPath, nil
+	case OrderBreadthFirst, OrderSize, OrderMtime:
+		return FileOrder(name), nil
+	}
+	return "", NewConfigError(
+		fmt.Sprintf(
+			"unknown order: %s. Supported orders are '%s', '%s', '%s' and '%s'",
+			name, OrderPath, OrderBreadthFirst, OrderSize, OrderMtime,
+		),
+		nil,
+	)
+}
+
+// orderKey holds what entries are sorted by
+type orderKey struct {
+	// index of the first matching priority pattern, or the number of patterns
+	priority int
+	depth    int
+	size     int64
+	modTime  time.Time
+	path     string
+}
+
+// orderSourceEntries sorts the entries collected by collectSourceEntries.
+// Files matching a priority pattern come first, in the order of the
+// patterns, and the others follow in config.Order. Ties are broken by path
+// so identical inputs always give identical output files.
+func orderSourceEntries(fsys fs.FS, sourceEntries []sourceEntry, config *BalerConfig) *BalerError {
+	order, balerErr := ParseFileOrder(string(config.Order))
+	if balerErr != nil {
+		return balerErr
+	}
+	var priorityPatterns []string
+	if config.PriorityPatterns != nil {
+		priorityPatterns = *config.PriorityPatterns
+	}
+	keys := make(map[string]orderKey, len(sourceEntries))
+	for _, source := range sourceEntries {
+		key := orderKey{priority: len(priorityPatterns), path: source.relPath}
+		key.depth = strings.Count(key.path, "/")
+		if !source.isDir {
+			for i, pattern := range priorityPatterns {
+				matches, err := matchGlob(pattern, key.path)
+				if err != nil {
+					return NewValidationError(
+						fmt.Sprintf("error matching path with priority pattern: %s %s", pattern, key.path),
+						err,
+					)
+				}
+				if matches {
+					key.priority = i
+					break
+				}
+			}
+			if order == OrderSize || order == OrderMtime {
+				// files which can't be read fail while converting
+				if info, err := fs.Stat(fsys, source.relPath); err == nil {
+					key.size = info.Size()
+					key.modTime = info.ModTime()
+				}
+			}
+		}
+		keys[source.relPath] = key
+	}
+	sort.SliceStable(sourceEntries, func(i, j int) bool {
+		a, b := keys[sourceEntries[i].relPath], keys[sourceEntries[j].relPath]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		switch order {
+		case OrderBreadthFirst:
+			if a.depth != b.depth {
+				return a.depth < b.depth
+			}
+		case OrderSize:
+			if a.size != b.size {
+				return a.size < b.size
+			}
+		case OrderMtime:
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.After(b.modTime)
+			}
+		}
+		return a.path < b.path
+	})
+	return nil
+}
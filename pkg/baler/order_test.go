@@ -0,0 +1,158 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderSourceEntries(t *testing.T) {
+	sourceDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	files := map[string]string{
+		"README.md":   strings.Repeat("r", 30),
+		"go.mod":      strings.Repeat("g", 20),
+		"a.txt":       strings.Repeat("a", 40),
+		"b/z.go":      strings.Repeat("z", 10),
+		"b/c/d.txt":   strings.Repeat("d", 50),
+		"b.txt":       strings.Repeat("b", 10),
+		"b/c/e/f.txt": strings.Repeat("f", 5),
+	}
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// modification times in the order of the names
+	for i, name := range []string{"README.md", "go.mod", "a.txt", "b/z.go", "b/c/d.txt", "b.txt", "b/c/e/f.txt"} {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		createTestFile(t, filepath.Dir(path), filepath.Base(path), files[name])
+		if err := os.Chtimes(path, modTime, modTime.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	config := &BalerConfig{Logger: &NoopLogger{}}
+	errs := newErrorCollector(config)
+
+	tests := []struct {
+		name     string
+		order    FileOrder
+		priority []string
+		expected []string
+	}{
+		{
+			name:     "default",
+			expected: []string{"README.md", "a.txt", "b.txt", "b/c/d.txt", "b/c/e/f.txt", "b/z.go", "go.mod"},
+		},
+		{
+			name:     "breadth-first",
+			order:    OrderBreadthFirst,
+			expected: []string{"README.md", "a.txt", "b.txt", "go.mod", "b/z.go", "b/c/d.txt", "b/c/e/f.txt"},
+		},
+		{
+			name:     "size",
+			order:    OrderSize,
+			expected: []string{"b/c/e/f.txt", "b.txt", "b/z.go", "go.mod", "README.md", "a.txt", "b/c/d.txt"},
+		},
+		{
+			name:     "mtime",
+			order:    OrderMtime,
+			expected: []string{"b/c/e/f.txt", "b.txt", "b/c/d.txt", "b/z.go", "a.txt", "go.mod", "README.md"},
+		},
+		{
+			name:     "priority",
+			priority: []string{"go.mod", "README*", "**/*.go"},
+			expected: []string{"go.mod", "README.md", "b/z.go", "a.txt", "b.txt", "b/c/d.txt", "b/c/e/f.txt"},
+		},
+		{
+			name:     "priority with size",
+			order:    OrderSize,
+			priority: []string{"**/*.txt"},
+			expected: []string{"b/c/e/f.txt", "b.txt", "a.txt", "b/c/d.txt", "b/z.go", "go.mod", "README.md"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Order = tt.order
+			config.PriorityPatterns = &tt.priority
+			sourceEntries, balerErr := collectSourceEntries(context.Background(), NewDirFS(sourceDir), config, errs)
+			if balerErr != nil {
+				t.Fatalf("Failed to collect entries: %v", balerErr)
+			}
+			if balerErr := orderSourceEntries(NewDirFS(sourceDir), sourceEntries, config); balerErr != nil {
+				t.Fatalf("Failed to order entries: %v", balerErr)
+			}
+			paths := []string{}
+			for _, source := range sourceEntries {
+				if !source.isDir {
+					paths = append(paths, filepath.ToSlash(source.relPath))
+				}
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, paths)
+			}
+		})
+	}
+
+	config.Order = "random"
+	if balerErr := orderSourceEntries(NewDirFS(sourceDir), nil, config); balerErr == nil || balerErr.Type != ErrorTypeConfig {
+		t.Errorf("Expected a configuration error, got %v", balerErr)
+	}
+}
+
+func TestConvertIsDeterministic(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+
+	for _, name := range []string{"z", "a", "m", "b"} {
+		dir := filepath.Join(sourceDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		for _, file := range []string{"y.txt", "c.txt", "k.txt"} {
+			createTestFile(t, dir, file, strings.Repeat(name+file, 20)+"\n")
+		}
+	}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 1024,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+	}
+	var outputs [][]byte
+	for i := 0; i < 2; i++ {
+		destDir, destCleanup := setupTestDir(t)
+		defer destCleanup()
+		if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+			t.Fatalf("Convert failed: %v", balerErr)
+		}
+		paths, err := filepath.Glob(filepath.Join(destDir, "output_*.txt"))
+		if err != nil {
+			t.Fatalf("Failed to list output files: %v", err)
+		}
+		var output []byte
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			output = append(output, content...)
+		}
+		outputs = append(outputs, output)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("Expected identical output files for identical inputs")
+	}
+	first := bytes.Index(outputs[0], []byte("// filename: a/c.txt"))
+	last := bytes.Index(outputs[0], []byte("// filename: z/y.txt"))
+	if first == -1 || last == -1 || first > last {
+		t.Error("Expected files to be sorted by path")
+	}
+}
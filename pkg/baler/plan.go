@@ -0,0 +1,189 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+type PlanAction string
+
+const (
+	PlanCreate    PlanAction = "create"
+	PlanOverwrite PlanAction = "overwrite"
+	// PlanUnchanged files already have the content and mode of the bundle
+	PlanUnchanged PlanAction = "unchanged"
+	// PlanConflict files can't be written, e.g/ the path is a directory
+	PlanConflict PlanAction = "conflict"
+	// PlanSkip files have unsafe paths, and are skipped with SkipUnsafePaths
+	PlanSkip PlanAction = "skip"
+)
+
+// PlannedFile is what UnConvert does with a file of the bundle
+type PlannedFile struct {
+	// slash separated path relative to the destination directory
+	Path   string
+	Action PlanAction
+	// size of the file in the bundle, and of the existing file
+	Size         int64
+	PreviousSize int64
+	// why the file can't be written, for PlanConflict and PlanSkip
+	Reason string
+	entry  *bundleEntry
+	// permissions of the existing file
+	previousMode fs.FileMode
+}
+
+// UnconvertPlan lists the files of a bundle in the order they are found
+type UnconvertPlan struct {
+	Files []PlannedFile
+}
+
+// Count returns the number of files planned with an action
+func (p *UnconvertPlan) Count(action PlanAction) int {
+	count := 0
+	for _, file := range p.Files {
+		if file.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// planEntry compares an entry of the bundle with the destination
+func planEntry(entry *bundleEntry, dst fs.FS) (PlannedFile, *BalerError) {
+	planned := PlannedFile{Path: entry.Path, Size: int64(len(entry.Content)), entry: entry}
+	if reason, balerErr := unsafePathReason(entry.Path, dst); balerErr != nil {
+		return planned, balerErr
+	} else if reason != "" {
+		planned.Action = PlanSkip
+		planned.Reason = reason
+		return planned, nil
+	}
+	name := fsName(entry.Path)
+	// parents which are files would have to be directories
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		parentName := strings.Join(parts[:i], "/")
+		parentInfo, err := fs.Stat(dst, parentName)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		} else if err != nil {
+			return planned, NewIOError(fmt.Sprintf("unable to get information on %s", displayPath(dst, parentName)), err)
+		}
+		if !parentInfo.IsDir() {
+			planned.Action = PlanConflict
+			planned.Reason = fmt.Sprintf("%s is a file on disk", parentName)
+			return planned, nil
+		}
+	}
+
+	destinationPath := displayPath(dst, name)
+	info, err := fs.Stat(dst, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		planned.Action = PlanCreate
+		return planned, nil
+	} else if err != nil {
+		return planned, NewIOError(fmt.Sprintf("unable to get information on %s", destinationPath), err)
+	}
+	if info.IsDir() {
+		planned.Action = PlanConflict
+		planned.Reason = "is a directory on disk"
+		return planned, nil
+	}
+	if !info.Mode().IsRegular() {
+		planned.Action = PlanConflict
+		planned.Reason = "is not a regular file on disk"
+		return planned, nil
+	}
+	planned.PreviousSize = info.Size()
+	planned.previousMode = info.Mode().Perm()
+	existing, err := fs.ReadFile(dst, name)
+	if err != nil {
+		return planned, NewIOError(fmt.Sprintf("unable to read: %s", destinationPath), err)
+	}
+	// permissions are only compared for formats which store them
+	if bytes.Equal(existing, entry.Content) && (entry.Mode == 0 || entry.Mode.Perm() == info.Mode().Perm()) {
+		planned.Action = PlanUnchanged
+	} else {
+		planned.Action = PlanOverwrite
+	}
+	return planned, nil
+}
+
+// PlanUnConvert reads the bundle src and compares every file with dst,
+// without writing anything. UnConvert executes this plan.
+func PlanUnConvert(ctx context.Context, src BundleReader, dst fs.FS, config *BalerConfig) (*UnconvertPlan, *BalerError) {
+	errs := newErrorCollector(config)
+	plan, balerErr := planUnConvert(ctx, src, dst, config, errs)
+	if balerErr != nil {
+		return nil, balerErr
+	}
+	// entries skipped with IgnoreErrors
+	return plan, errs.result()
+}
+
+func planUnConvert(ctx context.Context, src BundleReader, dst fs.FS, config *BalerConfig, errs *errorCollector) (*UnconvertPlan, *BalerError) {
+	if balerErr := checkDirectory(dst, "destination directory"); balerErr != nil {
+		return nil, balerErr
+	}
+	plan := &UnconvertPlan{}
+	// index of every file in plan.Files by fsName, so that e.g/ "./a.txt" and
+	// "a.txt" are the same file. Later entries replace earlier ones.
+	indexes := make(map[string]int)
+	balerErr := src.read(config, errs, func(entry *bundleEntry) *BalerError {
+		if balerErr := checkCanceled(ctx); balerErr != nil {
+			return balerErr
+		}
+		planned, balerErr := planEntry(entry, dst)
+		if balerErr != nil {
+			return errs.handle(entry.Path, balerErr)
+		}
+		if planned.Action == PlanSkip {
+			if !config.SkipUnsafePaths {
+				balerErr := NewValidationError(fmt.Sprintf("unsafe path %q: %s", planned.Path, planned.Reason), nil)
+				if balerErr = errs.handle(planned.Path, balerErr); balerErr != nil {
+					return balerErr
+				}
+				plan.Files = append(plan.Files, planned)
+				return nil
+			}
+			config.Logger.Warn("Skipping unsafe path", "path", planned.Path, "reason", planned.Reason)
+			plan.Files = append(plan.Files, planned)
+			return nil
+		}
+		name := fsName(entry.Path)
+		if index, ok := indexes[name]; ok {
+			if config.Verbose {
+				config.Logger.Warn("File found more than once, the last one is used", "path", entry.Path)
+			}
+			plan.Files[index] = planned
+			return nil
+		}
+		indexes[name] = len(plan.Files)
+		plan.Files = append(plan.Files, planned)
+		return nil
+	})
+	if balerErr != nil {
+		return nil, balerErr
+	}
+	// files of the bundle which are parents of other files
+	for i, planned := range plan.Files {
+		if planned.Action == PlanSkip {
+			continue
+		}
+		parts := strings.Split(fsName(planned.Path), "/")
+		for j := 1; j < len(parts); j++ {
+			parent := strings.Join(parts[:j], "/")
+			if _, ok := indexes[parent]; ok {
+				plan.Files[i].Action = PlanConflict
+				plan.Files[i].Reason = fmt.Sprintf("%s is a file in the bundle", parent)
+				break
+			}
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,111 @@
+package baler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanUnConvert(t *testing.T) {
+	files := map[string]string{
+		"new.txt":       "new\n",
+		"changed.txt":   "changed\n",
+		"same.txt":      "same\n",
+		"dir.txt":       "a file\n",
+		"parent/in.txt": "in\n",
+	}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+	}
+	destDir := convertTestTree(t, files, config)
+	targetDir := newTestDir(t)
+	createTestFile(t, targetDir, "changed.txt", "old\n")
+	createTestFile(t, targetDir, "same.txt", "same\n")
+	createTestFile(t, targetDir, "parent", "a file where a directory is expected\n")
+	if err := os.Mkdir(filepath.Join(targetDir, "dir.txt"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	plan, balerErr := PlanUnConvert(context.Background(), NewDirBundleReader(destDir), NewDirFS(targetDir), unconvertConfig)
+	if balerErr != nil {
+		t.Fatalf("PlanUnConvert failed: %v", balerErr)
+	}
+	expected := map[string]PlanAction{
+		"new.txt":       PlanCreate,
+		"changed.txt":   PlanOverwrite,
+		"same.txt":      PlanUnchanged,
+		"dir.txt":       PlanConflict,
+		"parent/in.txt": PlanConflict,
+	}
+	if len(plan.Files) != len(expected) {
+		t.Fatalf("Expected %d planned files, got %+v", len(expected), plan.Files)
+	}
+	for _, planned := range plan.Files {
+		if action := expected[planned.Path]; action != planned.Action {
+			t.Errorf("Expected action %q for %s, got %q", action, planned.Path, planned.Action)
+		}
+		if planned.Path == "changed.txt" && (planned.PreviousSize != 4 || planned.Size != 8) {
+			t.Errorf("Expected size 4 -> 8 for changed.txt, got %d -> %d", planned.PreviousSize, planned.Size)
+		}
+	}
+
+	// conflicts stop unconvert before anything is written
+	balerErr = UnConvertDir(context.Background(), destDir, targetDir, unconvertConfig)
+	if balerErr == nil || balerErr.Type != ErrorTypeValidation {
+		t.Fatalf("Expected a validation error, got %v", balerErr)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "new.txt")); err == nil {
+		t.Error("Expected new.txt not to be written")
+	}
+
+	// without conflicts, the plan is executed
+	if err := os.Remove(filepath.Join(targetDir, "dir.txt")); err != nil {
+		t.Fatalf("Failed to remove directory: %v", err)
+	}
+	if err := os.Remove(filepath.Join(targetDir, "parent")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if balerErr := UnConvertDir(context.Background(), destDir, targetDir, unconvertConfig); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	assertTestTree(t, targetDir, files)
+}
+
+func TestPlanUnConvertCleansPaths(t *testing.T) {
+	// the same files, with paths which aren't clean
+	stream := "// filename: ./a.txt\nold\n\n// filename: a.txt\nnewer\n\n// filename: ./d\nd\n\n// filename: d/e.txt\ne\n\n"
+	config := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatText,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	plan, balerErr := PlanUnConvert(context.Background(), NewStreamBundleReader(strings.NewReader(stream)), NewDirFS(newTestDir(t)), config)
+	if balerErr != nil {
+		t.Fatalf("PlanUnConvert failed: %v", balerErr)
+	}
+	if len(plan.Files) != 3 {
+		t.Fatalf("Expected 3 planned files, got %+v", plan.Files)
+	}
+	if plan.Files[0].Action != PlanCreate || plan.Files[0].Size != 6 {
+		t.Errorf("Expected the last a.txt to be created, got %+v", plan.Files[0])
+	}
+	if plan.Files[2].Action != PlanConflict {
+		t.Errorf("Expected d/e.txt to conflict with ./d, got %+v", plan.Files[2])
+	}
+}
@@ -0,0 +1,64 @@
+package baler
+
+// Progress is a snapshot of a running Convert or UnConvert
+type Progress struct {
+	Operation OperationType
+	// files to handle, known once the input is walked or the bundle planned
+	FilesTotal int
+	// files handled so far, written or skipped
+	FilesSeen    int
+	FilesWritten int
+	// files which aren't written, e.g/ they fail validation, can't be read
+	// with IgnoreErrors, or are unchanged while unconverting
+	FilesSkipped int
+	// size of the files written so far
+	BytesWritten int64
+	// output file being written by Convert
+	OutputFile string
+	// last file handled
+	Path string
+}
+
+// ProgressObserver is notified by Convert and UnConvert once the number of
+// files is known, and after every file, from the goroutine calling them
+type ProgressObserver interface {
+	Progress(progress Progress)
+}
+
+// progressTracker keeps the progress of an operation, and notifies the
+// observer of the config if there is one
+type progressTracker struct {
+	observer ProgressObserver
+	progress Progress
+}
+
+func newProgressTracker(config *BalerConfig, operation OperationType, filesTotal int) *progressTracker {
+	tracker := &progressTracker{
+		observer: config.Progress,
+		progress: Progress{Operation: operation, FilesTotal: filesTotal},
+	}
+	tracker.notify()
+	return tracker
+}
+
+func (t *progressTracker) notify() {
+	if t.observer != nil {
+		t.observer.Progress(t.progress)
+	}
+}
+
+// written records a file written, size is the length of its content
+func (t *progressTracker) written(path string, size int64) {
+	t.progress.FilesSeen++
+	t.progress.FilesWritten++
+	t.progress.BytesWritten += size
+	t.progress.Path = path
+	t.notify()
+}
+
+func (t *progressTracker) skipped(path string) {
+	t.progress.FilesSeen++
+	t.progress.FilesSkipped++
+	t.progress.Path = path
+	t.notify()
+}
@@ -0,0 +1,156 @@
+package baler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// progressRecorder keeps every progress notification, and calls onProgress
+type progressRecorder struct {
+	snapshots  []Progress
+	onProgress func(progress Progress)
+}
+
+func (r *progressRecorder) Progress(progress Progress) {
+	r.snapshots = append(r.snapshots, progress)
+	if r.onProgress != nil {
+		r.onProgress(progress)
+	}
+}
+
+func (r *progressRecorder) last() Progress {
+	return r.snapshots[len(r.snapshots)-1]
+}
+
+func TestProgress(t *testing.T) {
+	source := fstest.MapFS{
+		"a.txt":       {Data: []byte(strings.Repeat("a", 300))},
+		"b.txt":       {Data: []byte(strings.Repeat("b", 300))},
+		"lib/c.txt":   {Data: []byte("c\n")},
+		"binary.dat":  {Data: []byte{0xff, 0xfe, 0x00}},
+		"oversize.md": {Data: []byte(strings.Repeat("x", 2048))},
+	}
+	recorder := &progressRecorder{}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 1000,
+		MaxOutputFileSize: 512,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+		Progress:          recorder,
+	}
+	bundle := memoryBundle{}
+	if _, balerErr := Convert(context.Background(), source, bundle, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	expected := Progress{
+		Operation:    OperationConvert,
+		FilesTotal:   5,
+		FilesSeen:    5,
+		FilesWritten: 3,
+		FilesSkipped: 2,
+		BytesWritten: 602,
+		OutputFile:   "output_1.txt",
+		Path:         "oversize.md",
+	}
+	if recorder.last() != expected {
+		t.Errorf("Expected %+v, got %+v", expected, recorder.last())
+	}
+	// once before the first file, and after every file
+	if len(recorder.snapshots) != 6 || recorder.snapshots[0].FilesSeen != 0 {
+		t.Errorf("Expected 6 notifications, got %+v", recorder.snapshots)
+	}
+
+	destination := memoryFS{fstest.MapFS{"a.txt": {Data: []byte(strings.Repeat("a", 300))}}}
+	recorder.snapshots = nil
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+		Progress:         recorder,
+	}
+	if balerErr := UnConvert(context.Background(), NewFSBundleReader(fstest.MapFS(bundle)), destination, unconvertConfig); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	last := recorder.last()
+	if last.Operation != OperationUnconvert || last.FilesTotal != 3 || last.FilesWritten != 2 || last.FilesSkipped != 1 || last.BytesWritten != 302 {
+		t.Errorf("Unexpected progress of unconvert: %+v", last)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		createTestFile(t, sourceDir, name, name+"\n")
+	}
+
+	// partial output files are removed
+	ctx, cancel := context.WithCancel(context.Background())
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 1000,
+		MaxOutputFileSize: 1024,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+		Progress: &progressRecorder{onProgress: func(progress Progress) {
+			if progress.FilesWritten == 1 {
+				cancel()
+			}
+		}},
+	}
+	_, balerErr := ConvertDir(ctx, sourceDir, destDir, config)
+	if balerErr == nil || balerErr.Type != ErrorTypeCanceled || !errors.Is(balerErr, context.Canceled) {
+		t.Fatalf("Expected convert to be canceled, got %v", balerErr)
+	}
+	if entries, err := os.ReadDir(destDir); err != nil || len(entries) != 0 {
+		t.Errorf("Expected an empty output directory, got %v, %v", entries, err)
+	}
+
+	config.Progress = nil
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		createTestFile(t, sourceDir, name, "changed\n")
+	}
+
+	// files moved into place are rolled back
+	ctx, cancel = context.WithCancel(context.Background())
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+		Progress: &progressRecorder{onProgress: func(progress Progress) {
+			if progress.FilesWritten == 1 {
+				cancel()
+			}
+		}},
+	}
+	balerErr = UnConvertDir(ctx, destDir, sourceDir, unconvertConfig)
+	if balerErr == nil || balerErr.Type != ErrorTypeCanceled {
+		t.Fatalf("Expected unconvert to be canceled, got %v", balerErr)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if content, err := os.ReadFile(filepath.Join(sourceDir, name)); err != nil || string(content) != "changed\n" {
+			t.Errorf("Expected %s to be restored, got %q, %v", name, content, err)
+		}
+	}
+	entries, err := os.ReadDir(sourceDir)
+	if err != nil || len(entries) != 3 {
+		t.Errorf("Expected no staging or backup directory left, got %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,155 @@
+package baler
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Report lists what Convert or UnConvert did, e.g/ to check it in CI. Set
+// BalerConfig.Report to a new Report to have it filled, once per operation.
+type Report struct {
+	Operation OperationType `json:"operation"`
+	Version   string        `json:"version"`
+	// files converted, or written while unconverting
+	Files   []ReportFile        `json:"files"`
+	Skipped []ReportSkippedFile `json:"skipped"`
+	// output files of Convert
+	OutputFiles []ReportOutputFile `json:"output_files,omitempty"`
+	Timings     ReportTimings      `json:"timings"`
+	// error which stopped the operation, or the files skipped with IgnoreErrors
+	Error string `json:"error,omitempty"`
+
+	started time.Time
+	// beginning of the current phase, for Timings
+	phase time.Time
+}
+
+type ReportFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Convert only, tokens are 0 without a tokenizer
+	Lines      int    `json:"lines,omitempty"`
+	Tokens     uint64 `json:"tokens,omitempty"`
+	OutputFile string `json:"output_file,omitempty"`
+	// UnConvert only, PlanCreate or PlanOverwrite
+	Action PlanAction `json:"action,omitempty"`
+}
+
+type ReportSkippedFile struct {
+	Path   string     `json:"path"`
+	Reason SkipReason `json:"reason"`
+	// 0 when the file isn't read, e.g/ it's excluded
+	Size uint64 `json:"size,omitempty"`
+	// e.g/ the exclusion pattern, or the error
+	Detail string `json:"detail,omitempty"`
+}
+
+type ReportOutputFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// number of converted files it contains
+	Files int `json:"files"`
+}
+
+// ReportTimings are durations in milliseconds
+type ReportTimings struct {
+	// walking the input directory, or reading the output files and
+	// comparing them with the destination
+	ScanMS float64 `json:"scan_ms"`
+	// first pass over the input files, for Tree and DelimiterAuto
+	ValidateMS float64 `json:"validate_ms,omitempty"`
+	WriteMS    float64 `json:"write_ms"`
+	TotalMS    float64 `json:"total_ms"`
+}
+
+// JSON returns the indented JSON of the report
+func (r *Report) JSON() ([]byte, *BalerError) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, NewInternalError("unable to encode report", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// start is a no-op when the report is already started, e.g/ Convert
+// called by ConvertDir. The methods of a nil report do nothing.
+func (r *Report) start(operation OperationType) {
+	if r == nil || !r.started.IsZero() {
+		return
+	}
+	r.Operation = operation
+	r.Version = Version
+	r.Files = []ReportFile{}
+	r.Skipped = []ReportSkippedFile{}
+	r.started = time.Now()
+	r.phase = r.started
+}
+
+// lap returns the milliseconds since the last lap, or the start
+func (r *Report) lap() float64 {
+	now := time.Now()
+	elapsed := now.Sub(r.phase)
+	r.phase = now
+	return milliseconds(elapsed)
+}
+
+func (r *Report) scanned() {
+	if r != nil {
+		r.Timings.ScanMS = r.lap()
+	}
+}
+
+func (r *Report) validated() {
+	if r != nil {
+		r.Timings.ValidateMS = r.lap()
+	}
+}
+
+func (r *Report) written() {
+	if r != nil {
+		r.Timings.WriteMS = r.lap()
+	}
+}
+
+func (r *Report) include(file ReportFile) {
+	if r != nil {
+		r.Files = append(r.Files, file)
+	}
+}
+
+func (r *Report) skip(path string, reason SkipReason, size uint64, detail string) {
+	if r != nil {
+		r.Skipped = append(r.Skipped, ReportSkippedFile{Path: path, Reason: reason, Size: size, Detail: detail})
+	}
+}
+
+// output records a closed output file, after the files it contains
+func (r *Report) output(name string, size int64) {
+	if r == nil {
+		return
+	}
+	files := 0
+	for _, file := range r.Files {
+		if file.OutputFile == name {
+			files++
+		}
+	}
+	r.OutputFiles = append(r.OutputFiles, ReportOutputFile{Name: name, Size: size, Files: files})
+}
+
+// finish records the total duration and the error of the operation, it
+// can be called again, e.g/ by ConvertDir once output files are moved
+func (r *Report) finish(balerErr *BalerError) {
+	if r == nil {
+		return
+	}
+	r.Timings.TotalMS = milliseconds(time.Since(r.started))
+	r.Error = ""
+	if balerErr != nil {
+		r.Error = balerErr.Error()
+	}
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
@@ -0,0 +1,121 @@
+package baler
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReport(t *testing.T) {
+	source := fstest.MapFS{
+		"a.txt":       {Data: []byte(strings.Repeat("a", 300))},
+		"b.txt":       {Data: []byte(strings.Repeat("b", 300))},
+		"lib/c.txt":   {Data: []byte("c\n")},
+		"binary.dat":  {Data: []byte{0xff, 0xfe, 0x00}},
+		"oversize.md": {Data: []byte(strings.Repeat("x", 2048))},
+		"debug.log":   {Data: []byte("log\n")},
+	}
+	report := &Report{}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 1000,
+		MaxOutputFileSize: 512,
+		ExclusionPatterns: &[]string{"*.log"},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+		Report:            report,
+	}
+	bundle := memoryBundle{}
+	if _, balerErr := Convert(context.Background(), source, bundle, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	if report.Operation != OperationConvert || report.Error != "" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	expectedFiles := []ReportFile{
+		{Path: "a.txt", Size: 300, Lines: 1, OutputFile: "output_0.txt"},
+		{Path: "b.txt", Size: 300, Lines: 1, OutputFile: "output_1.txt"},
+		{Path: "lib/c.txt", Size: 2, Lines: 1, OutputFile: "output_1.txt"},
+	}
+	if !reflect.DeepEqual(report.Files, expectedFiles) {
+		t.Errorf("Expected files %+v, got %+v", expectedFiles, report.Files)
+	}
+	expectedSkipped := []ReportSkippedFile{
+		{Path: "debug.log", Reason: SkipExcluded, Detail: "*.log"},
+		{Path: "binary.dat", Reason: SkipBinary, Size: 3},
+		{Path: "oversize.md", Reason: SkipTooLarge, Size: 2048},
+	}
+	if !reflect.DeepEqual(report.Skipped, expectedSkipped) {
+		t.Errorf("Expected skipped files %+v, got %+v", expectedSkipped, report.Skipped)
+	}
+	if len(report.OutputFiles) != 2 {
+		t.Fatalf("Expected 2 output files, got %+v", report.OutputFiles)
+	}
+	for i, output := range report.OutputFiles {
+		if output.Size != int64(len(bundle[output.Name].Data)) || output.Files != i+1 {
+			t.Errorf("Unexpected output file %+v", output)
+		}
+	}
+	if report.Timings.TotalMS < report.Timings.ScanMS+report.Timings.WriteMS {
+		t.Errorf("Unexpected timings %+v", report.Timings)
+	}
+	data, balerErr := report.JSON()
+	if balerErr != nil {
+		t.Fatalf("JSON failed: %v", balerErr)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded["operation"] != "convert" {
+		t.Errorf("Unexpected JSON %s, %v", data, err)
+	}
+
+	// unchanged files are skipped
+	destination := memoryFS{fstest.MapFS{"a.txt": {Data: []byte(strings.Repeat("a", 300))}}}
+	report = &Report{}
+	unconvertConfig := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatAuto,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+		Report:           report,
+	}
+	if balerErr := UnConvert(context.Background(), NewFSBundleReader(fstest.MapFS(bundle)), destination, unconvertConfig); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	expectedFiles = []ReportFile{
+		{Path: "b.txt", Size: 300, Action: PlanCreate},
+		{Path: "lib/c.txt", Size: 2, Action: PlanCreate},
+	}
+	if report.Operation != OperationUnconvert || !reflect.DeepEqual(report.Files, expectedFiles) {
+		t.Errorf("Unexpected report of unconvert: %+v", report)
+	}
+	expectedSkipped = []ReportSkippedFile{{Path: "a.txt", Reason: SkipUnchanged, Size: 300}}
+	if !reflect.DeepEqual(report.Skipped, expectedSkipped) {
+		t.Errorf("Expected skipped files %+v, got %+v", expectedSkipped, report.Skipped)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	destDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	report := &Report{}
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 1000,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+		Report:            report,
+	}
+	if _, balerErr := ConvertDir(context.Background(), filepath.Join(destDir, "missing"), destDir, config); balerErr == nil {
+		t.Fatal("Expected convert to fail")
+	}
+	if report.Operation != OperationConvert || !strings.Contains(report.Error, "missing") {
+		t.Errorf("Expected the error in the report, got %+v", report)
+	}
+}
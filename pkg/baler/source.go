@@ -0,0 +1,126 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"sync"
+)
+
+// sourceFile is a file of the input loaded by loadSourceFile
+type sourceFile struct {
+	validation *ValidationResult
+	// nil when the file isn't valid
+	entry *bundleEntry
+	info  fs.FileInfo
+	// slash counts of the lines matching autoDelimiterPattern
+	delimiterSlashes []int
+	err              *BalerError
+}
+
+// loadSourceFile reads and validates a file, so that it's read only once.
+// Files larger than MaxInputFileSize aren't read.
+func loadSourceFile(fsys fs.FS, source sourceEntry, config *BalerConfig) *sourceFile {
+	sourcePath := displayPath(fsys, source.relPath)
+	info, err := fs.Stat(fsys, source.relPath)
+	if err != nil {
+		return &sourceFile{err: NewIOError(fmt.Sprintf("failed to get file info for: %s", sourcePath), err)}
+	}
+	if info.Size() > int64(config.MaxInputFileSize) {
+		return &sourceFile{validation: oversizedFile(info), info: info}
+	}
+	content, err := fs.ReadFile(fsys, source.relPath)
+	if err != nil {
+		return &sourceFile{err: NewIOError(fmt.Sprintf("unable to read: %s", sourcePath), err)}
+	}
+	validation, balerErr := validateContent(sourcePath, content, config)
+	if balerErr != nil {
+		return &sourceFile{err: balerErr}
+	}
+	file := &sourceFile{validation: validation, info: info}
+	if config.FileDelimiter == DelimiterAuto {
+		for _, line := range bytes.Split(content, []byte("\n")) {
+			if match := autoDelimiterPattern.FindSubmatch(line); match != nil {
+				file.delimiterSlashes = append(file.delimiterSlashes, len(match[1]))
+			}
+		}
+	}
+	if validation.isValid() {
+		file.entry = &bundleEntry{Path: source.relPath, Content: content, Mode: info.Mode().Perm()}
+	}
+	return file
+}
+
+// scanSourceFiles calls load for the files of sourceEntries with config.Jobs
+// workers, and handle with the result of every entry in the order of
+// sourceEntries, nil for directories. The results of at most about twice
+// as many files as workers are held in memory at once. It stops once ctx
+// is done.
+func scanSourceFiles(
+	ctx context.Context,
+	sourceEntries []sourceEntry,
+	config *BalerConfig,
+	load func(index int, source sourceEntry) *sourceFile,
+	handle func(index int, file *sourceFile) *BalerError,
+) *BalerError {
+	workers := config.Jobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	type job struct {
+		index  int
+		source sourceEntry
+		// buffered, so that workers never wait for handle
+		result chan *sourceFile
+	}
+	jobs := make(chan job)
+	pending := make(chan job, workers)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	// workers finish their current file when handle fails
+	defer wg.Wait()
+	defer close(done)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.result <- load(j.index, j.source)
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		for index, source := range sourceEntries {
+			j := job{index: index, source: source, result: make(chan *sourceFile, 1)}
+			select {
+			case pending <- j:
+			case <-done:
+				return
+			}
+			if source.isDir {
+				j.result <- nil
+				continue
+			}
+			select {
+			case jobs <- j:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for j := range pending {
+		if balerErr := checkCanceled(ctx); balerErr != nil {
+			return balerErr
+		}
+		if balerErr := handle(j.index, <-j.result); balerErr != nil {
+			return balerErr
+		}
+	}
+	return nil
+}
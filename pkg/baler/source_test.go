@@ -0,0 +1,178 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestScanSourceFiles(t *testing.T) {
+	sourceEntries := []sourceEntry{}
+	for i := 0; i < 100; i++ {
+		sourceEntries = append(sourceEntries, sourceEntry{relPath: fmt.Sprintf("%03d", i), isDir: i%10 == 0})
+	}
+	// later files are loaded faster, so workers finish out of order
+	load := func(index int, source sourceEntry) *sourceFile {
+		time.Sleep(time.Duration(100-index) * 10 * time.Microsecond)
+		return &sourceFile{entry: &bundleEntry{Path: source.relPath}}
+	}
+
+	tests := []struct {
+		name string
+		jobs int
+	}{
+		{name: "single worker", jobs: 1},
+		{name: "several workers", jobs: 8},
+		{name: "default workers", jobs: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &BalerConfig{Jobs: tt.jobs}
+			next := 0
+			balerErr := scanSourceFiles(context.Background(), sourceEntries, config, load, func(index int, file *sourceFile) *BalerError {
+				if index != next {
+					t.Fatalf("Expected entry %d, got %d", next, index)
+				}
+				next++
+				if sourceEntries[index].isDir != (file == nil) {
+					t.Errorf("Expected a result only for files, got %v for %s", file, sourceEntries[index].relPath)
+				} else if file != nil && file.entry.Path != sourceEntries[index].relPath {
+					t.Errorf("Expected %s, got %s", sourceEntries[index].relPath, file.entry.Path)
+				}
+				return nil
+			})
+			if balerErr != nil || next != len(sourceEntries) {
+				t.Errorf("Expected every entry to be handled, got %d, %v", next, balerErr)
+			}
+		})
+	}
+
+	// workers stop once handle fails
+	var loaded atomic.Int32
+	config := &BalerConfig{Jobs: 4}
+	balerErr := scanSourceFiles(context.Background(), sourceEntries, config, func(index int, source sourceEntry) *sourceFile {
+		loaded.Add(1)
+		return &sourceFile{}
+	}, func(index int, file *sourceFile) *BalerError {
+		if index == 5 {
+			return NewIOError("failed", nil)
+		}
+		return nil
+	})
+	if balerErr == nil || balerErr.Message != "failed" {
+		t.Errorf("Expected the error of handle, got %v", balerErr)
+	}
+	if count := loaded.Load(); count > 20 {
+		t.Errorf("Expected workers to stop early, %d files were loaded", count)
+	}
+}
+
+func TestConvertJobs(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+
+	for i := 0; i < 50; i++ {
+		dir := filepath.Join(sourceDir, fmt.Sprintf("dir%d", i%5))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		createTestFile(t, dir, fmt.Sprintf("file%02d.txt", i), strings.Repeat(fmt.Sprintf("%d\n", i), i*5))
+	}
+	// skipped files are reported in the same order too
+	createTestFile(t, sourceDir, "large.txt", strings.Repeat("x", 2048))
+
+	var outputs [][]byte
+	for _, jobs := range []int{1, 8} {
+		destDir, destCleanup := setupTestDir(t)
+		defer destCleanup()
+		config := &BalerConfig{
+			MaxInputFileSize:  1024,
+			MaxInputFileLines: 1000,
+			MaxOutputFileSize: 2048,
+			ExclusionPatterns: &[]string{},
+			FileDelimiter:     DelimiterAuto,
+			Tree:              true,
+			Jobs:              jobs,
+			Logger:            &NoopLogger{},
+		}
+		if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+			t.Fatalf("Convert failed with %d jobs: %v", jobs, balerErr)
+		}
+		paths, err := filepath.Glob(filepath.Join(destDir, "output_*.txt"))
+		if err != nil || len(paths) < 2 {
+			t.Fatalf("Expected several output files, got %v, %v", paths, err)
+		}
+		var output []byte
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			output = append(output, []byte(filepath.Base(path)+"\n")...)
+			output = append(output, content...)
+		}
+		outputs = append(outputs, output)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("Expected identical output files whatever the number of jobs")
+	}
+}
+
+// countingFS counts the files read in fsys
+type countingFS struct {
+	fstest.MapFS
+	read map[string]int
+	mu   sync.Mutex
+}
+
+func (c *countingFS) ReadFile(name string) ([]byte, error) {
+	c.mu.Lock()
+	c.read[name]++
+	c.mu.Unlock()
+	return c.MapFS.ReadFile(name)
+}
+
+func TestConvertReadsFilesOnce(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		tree      bool
+		delimiter string
+	}{
+		{name: "Single pass", delimiter: "// filename: "},
+		{name: "Tree", tree: true, delimiter: "// filename: "},
+		{name: "Auto delimiter", delimiter: DelimiterAuto},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &countingFS{MapFS: fstest.MapFS{}, read: map[string]int{}}
+			for i := 0; i < 20; i++ {
+				source.MapFS[fmt.Sprintf("dir_%d/file_%02d.txt", i%3, i)] = &fstest.MapFile{Data: []byte(strings.Repeat("x\n", i))}
+			}
+			config := &BalerConfig{
+				MaxInputFileSize:  1024,
+				MaxInputFileLines: 100,
+				MaxOutputFileSize: 4096,
+				ExclusionPatterns: &[]string{},
+				FileDelimiter:     tt.delimiter,
+				Tree:              tt.tree,
+				Jobs:              4,
+				Logger:            &NoopLogger{},
+			}
+			if _, balerErr := Convert(context.Background(), source, memoryBundle{}, config); balerErr != nil {
+				t.Fatalf("Convert failed: %v", balerErr)
+			}
+			for name := range source.MapFS {
+				if count := source.read[name]; count != 1 {
+					t.Errorf("Expected %s to be read once, it was read %d times", name, count)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package baler
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a language model would see for a text.
+// CountTokens is called concurrently by the workers of convert.
+type Tokenizer interface {
+	Name() string
+	CountTokens(text []byte) uint64
+}
+
+const (
+	TokenizerBPE      = "bpe"
+	TokenizerEstimate = "estimate"
+)
+
+// EstimateTokenizer approximates token counts as one token per 4 characters.
+// It is cheap, and good enough for English prose and most source code.
+type EstimateTokenizer struct{}
+
+func (t *EstimateTokenizer) Name() string {
+	return TokenizerEstimate
+}
+
+func (t *EstimateTokenizer) CountTokens(text []byte) uint64 {
+	return uint64(math.Ceil(float64(utf8.RuneCount(text)) / 4))
+}
+
+// BPETokenizer is a byte level BPE tokenizer using tiktoken style ranks
+// and the cl100k pre-tokenization rules.
+type BPETokenizer struct {
+	name  string
+	ranks map[string]int
+}
+
+// vocab/baler_bpe.tiktoken is a 16k token vocabulary trained on source code
+// and documentation. It is smaller than the vocabularies used by hosted
+// models, so its counts are slightly pessimistic; load the model's own
+// rank file with NewBPETokenizer for exact counts.
+//
+//go:embed vocab/baler_bpe.tiktoken
+var embeddedBPEVocab string
+
+var (
+	defaultBPETokenizer     *BPETokenizer
+	defaultBPETokenizerErr  error
+	defaultBPETokenizerOnce sync.Once
+)
+
+// DefaultBPETokenizer returns the BPE tokenizer using the embedded vocabulary
+func DefaultBPETokenizer() (*BPETokenizer, error) {
+	defaultBPETokenizerOnce.Do(func() {
+		defaultBPETokenizer, defaultBPETokenizerErr = NewBPETokenizer(TokenizerBPE, strings.NewReader(embeddedBPEVocab))
+	})
+	return defaultBPETokenizer, defaultBPETokenizerErr
+}
+
+// NewBPETokenizer reads ranks in the tiktoken format, i.e one
+// "<base64 encoded token> <rank>" pair per line, e.g/ cl100k_base.tiktoken
+func NewBPETokenizer(name string, reader io.Reader) (*BPETokenizer, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid vocabulary entry at line %d", lineNumber)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token at line %d: %w", lineNumber, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank at line %d: %w", lineNumber, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("vocabulary doesn't contain byte %d", b)
+		}
+	}
+	return &BPETokenizer{name: name, ranks: ranks}, nil
+}
+
+func (t *BPETokenizer) Name() string {
+	return t.name
+}
+
+func (t *BPETokenizer) CountTokens(text []byte) uint64 {
+	var count uint64
+	for _, piece := range pretokenize(text) {
+		count += uint64(t.countPieceTokens(piece))
+	}
+	return count
+}
+
+// countPieceTokens repeatedly merges the adjacent pair of parts with
+// the lowest rank, until no pair is in the vocabulary
+func (t *BPETokenizer) countPieceTokens(piece []byte) int {
+	if _, ok := t.ranks[string(piece)]; ok {
+		return 1
+	}
+	// boundaries of the parts piece is split into
+	boundaries := make([]int, len(piece)+1)
+	for i := range boundaries {
+		boundaries[i] = i
+	}
+	for len(boundaries) > 2 {
+		bestRank := math.MaxInt
+		bestIndex := -1
+		for i := 0; i+2 < len(boundaries); i++ {
+			if rank, ok := t.ranks[string(piece[boundaries[i]:boundaries[i+2]])]; ok && rank < bestRank {
+				bestRank = rank
+				bestIndex = i
+			}
+		}
+		if bestIndex < 0 {
+			break
+		}
+		boundaries = append(boundaries[:bestIndex+1], boundaries[bestIndex+2:]...)
+	}
+	return len(boundaries) - 1
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+func isLetterOrNumber(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// pretokenize splits text into the pieces BPE merges can't cross. It
+// follows the cl100k pattern
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// which can't be expressed with regexp as it uses a lookahead.
+func pretokenize(text []byte) [][]byte {
+	var pieces [][]byte
+	runeAt := func(i int) (rune, int) {
+		if i >= len(text) {
+			return utf8.RuneError, 0
+		}
+		return utf8.DecodeRune(text[i:])
+	}
+	// scan returns the index after the run of runes matching fn, starting at i
+	scan := func(i int, fn func(rune) bool, limit int) int {
+		for count := 0; i < len(text) && (limit <= 0 || count < limit); count++ {
+			r, size := runeAt(i)
+			if !fn(r) {
+				break
+			}
+			i += size
+		}
+		return i
+	}
+	isPunctuation := func(r rune) bool {
+		return !unicode.IsSpace(r) && !isLetterOrNumber(r)
+	}
+
+	for start := 0; start < len(text); {
+		r, size := runeAt(start)
+		next, nextSize := runeAt(start + size)
+		end := start + size
+
+		switch {
+		case r == '\'' && matchContraction(text[start+size:]) > 0:
+			end = start + size + matchContraction(text[start+size:])
+		case unicode.IsLetter(r):
+			end = scan(start, unicode.IsLetter, 0)
+		case !isNewline(r) && !isLetterOrNumber(r) && nextSize > 0 && unicode.IsLetter(next):
+			end = scan(start+size, unicode.IsLetter, 0)
+		case unicode.IsNumber(r):
+			end = scan(start, unicode.IsNumber, 3)
+		case r == ' ' && nextSize > 0 && isPunctuation(next):
+			end = scan(scan(start+size, isPunctuation, 0), isNewline, 0)
+		case isPunctuation(r):
+			end = scan(scan(start, isPunctuation, 0), isNewline, 0)
+		default:
+			// whitespace
+			runEnd := scan(start, unicode.IsSpace, 0)
+			lastNewline := -1
+			for i := start; i < runEnd; i++ {
+				if isNewline(rune(text[i])) {
+					lastNewline = i
+				}
+			}
+			if lastNewline >= 0 {
+				end = lastNewline + 1
+			} else if runEnd < len(text) && runEnd-start > size {
+				// leave the last whitespace for the following piece
+				_, lastSize := utf8.DecodeLastRune(text[start:runEnd])
+				end = runEnd - lastSize
+			} else {
+				end = runEnd
+			}
+		}
+		pieces = append(pieces, text[start:end])
+		start = end
+	}
+	return pieces
+}
+
+// matchContraction returns the length of a contraction suffix like
+// "s" or "ll" at the beginning of text, or 0
+func matchContraction(text []byte) int {
+	for _, suffix := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+		if len(text) >= len(suffix) && strings.EqualFold(string(text[:len(suffix)]), suffix) {
+			return len(suffix)
+		}
+	}
+	return 0
+}
+
+// NewTokenizer returns the tokenizer known by name
+func NewTokenizer(name string) (Tokenizer, *BalerError) {
+	switch name {
+	case TokenizerBPE:
+		tokenizer, err := DefaultBPETokenizer()
+		if err != nil {
+			return nil, NewInternalError("unable to load embedded BPE vocabulary", err)
+		}
+		return tokenizer, nil
+	case TokenizerEstimate:
+		return &EstimateTokenizer{}, nil
+	}
+	return nil, NewConfigError(
+		fmt.Sprintf("unknown tokenizer: %s. Supported tokenizers are '%s' and '%s'", name, TokenizerBPE, TokenizerEstimate),
+		nil,
+	)
+}
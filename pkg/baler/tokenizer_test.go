@@ -0,0 +1,192 @@
+package baler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPretokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "Words and punctuation",
+			text:     "Hello, world!",
+			expected: []string{"Hello", ",", " world", "!"},
+		},
+		{
+			name:     "Contractions and numbers",
+			text:     "it's 12345",
+			expected: []string{"it", "'s", " ", "123", "45"},
+		},
+		{
+			name:     "Indentation keeps last space for the next word",
+			text:     "if x {\n    return\n}\n",
+			expected: []string{"if", " x", " {\n", "   ", " return", "\n", "}\n"},
+		},
+		{
+			name:     "Trailing whitespace",
+			text:     "end  ",
+			expected: []string{"end", "  "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, piece := range pretokenize([]byte(tt.text)) {
+				got = append(got, string(piece))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected pieces %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTokenizers(t *testing.T) {
+	text := []byte("package main\n\nfunc main() {\n\tfmt.Println(\"Hello, 世界\")\n}\n")
+
+	bpe, err := DefaultBPETokenizer()
+	if err != nil {
+		t.Fatalf("Failed to load embedded vocabulary: %v", err)
+	}
+	bpeTokens := bpe.CountTokens(text)
+	if bpeTokens == 0 || bpeTokens >= uint64(len(text)) {
+		t.Errorf("Expected BPE tokens between 0 and %d, got %d", len(text), bpeTokens)
+	}
+
+	estimate := &EstimateTokenizer{}
+	if tokens := estimate.CountTokens([]byte("abcdefghi")); tokens != 3 {
+		t.Errorf("Expected 3 estimated tokens, got %d", tokens)
+	}
+
+	// a vocabulary with only bytes tokenizes into bytes
+	var vocab bytes.Buffer
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	byteTokenizer, err := NewBPETokenizer("bytes", &vocab)
+	if err != nil {
+		t.Fatalf("Failed to load byte vocabulary: %v", err)
+	}
+	if tokens := byteTokenizer.CountTokens(text); tokens != uint64(len(text)) {
+		t.Errorf("Expected %d tokens, got %d", len(text), tokens)
+	}
+
+	if _, err := NewBPETokenizer("invalid", strings.NewReader("YQ== 0\n")); err == nil {
+		t.Error("Expected error for vocabulary without all bytes")
+	}
+	if _, balerErr := NewTokenizer("unknown"); balerErr == nil {
+		t.Error("Expected error for unknown tokenizer")
+	}
+}
+
+func TestConvertWithMaxOutputTokens(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		createTestFile(t, sourceDir, name, strings.Repeat("abcd", 100))
+	}
+	createTestFile(t, sourceDir, "large.txt", strings.Repeat("abcd", 1000))
+
+	config := &BalerConfig{
+		MaxInputFileSize:   1024 * 1024,
+		MaxInputFileLines:  1000,
+		MaxOutputFileSize:  10 * 1024 * 1024,
+		MaxInputFileTokens: 500,
+		MaxOutputTokens:    250,
+		ExclusionPatterns:  &[]string{},
+		FileDelimiter:      "// filename: ",
+		Tokenizer:          &EstimateTokenizer{},
+		Logger:             &NoopLogger{},
+	}
+	processedFiles, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	for _, file := range *processedFiles {
+		if file == "large.txt" {
+			t.Error("Expected large.txt to be skipped for exceeding max input file tokens")
+		}
+	}
+
+	outputFiles, err := filepath.Glob(filepath.Join(destDir, "output_*.txt"))
+	if err != nil {
+		t.Fatalf("Failed to list output files: %v", err)
+	}
+	// each file has ~100 tokens, so at most 2 fit in an output file
+	if len(outputFiles) != 2 {
+		t.Errorf("Expected 2 output files, got %d", len(outputFiles))
+	}
+	for _, outputFile := range outputFiles {
+		content, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		if tokens := config.Tokenizer.CountTokens(content); tokens > config.MaxOutputTokens {
+			t.Errorf("Expected at most %d tokens in %s, got %d", config.MaxOutputTokens, filepath.Base(outputFile), tokens)
+		}
+	}
+}
+
+func TestMaxOutputTokensFormats(t *testing.T) {
+	sourceDir := newTestDir(t)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		createTestFile(t, sourceDir, name, strings.Repeat("abcd", 100))
+	}
+	for _, format := range []OutputFormat{FormatText, FormatMarkdown, FormatXML, FormatJSONL} {
+		// with 100 tokens, every file exceeds the limit and is written alone
+		for _, maxOutputTokens := range []uint64{250, 100} {
+			t.Run(fmt.Sprintf("%s %d", format, maxOutputTokens), func(t *testing.T) {
+				destDir := newTestDir(t)
+				config := &BalerConfig{
+					MaxInputFileSize:  1024 * 1024,
+					MaxInputFileLines: 1000,
+					MaxOutputFileSize: 10 * 1024 * 1024,
+					MaxOutputTokens:   maxOutputTokens,
+					ExclusionPatterns: &[]string{},
+					FileDelimiter:     "// filename: ",
+					Format:            format,
+					Tokenizer:         &EstimateTokenizer{},
+					Logger:            &NoopLogger{},
+				}
+				if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+					t.Fatalf("Convert failed: %v", balerErr)
+				}
+				outputFiles, err := filepath.Glob(filepath.Join(destDir, "output_*.txt"))
+				if err != nil {
+					t.Fatalf("Failed to list output files: %v", err)
+				}
+				if maxOutputTokens == 100 && len(outputFiles) != 3 {
+					t.Errorf("Expected 3 output files, got %d", len(outputFiles))
+				}
+				for _, outputFile := range outputFiles {
+					content, err := os.ReadFile(outputFile)
+					if err != nil {
+						t.Fatalf("Failed to read output file: %v", err)
+					}
+					if !strings.Contains(string(content), "abcd") {
+						t.Errorf("Expected a file in %s, got %q", filepath.Base(outputFile), content)
+					}
+					tokens := config.Tokenizer.CountTokens(content)
+					if maxOutputTokens == 250 && tokens > maxOutputTokens {
+						t.Errorf("Expected at most %d tokens in %s, got %d", maxOutputTokens, filepath.Base(outputFile), tokens)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package baler
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// treeNode is a file or directory of the directory tree header
+type treeNode struct {
+	name     string
+	isDir    bool
+	note     string
+	children map[string]*treeNode
+}
+
+func (n *treeNode) add(child *treeNode) {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	n.children[child.name] = child
+}
+
+// child returns the child directory name of n, creating it if needed
+func (n *treeNode) child(name string) *treeNode {
+	if existing, ok := n.children[name]; ok {
+		return existing
+	}
+	child := &treeNode{name: name, isDir: true}
+	n.add(child)
+	return child
+}
+
+// FormatSize returns a size in bytes, KiB or MiB, e.g/ "1.5 KiB"
+func FormatSize(size uint64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KiB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1024*1024))
+	}
+}
+
+// skipDescriptions are the notes of files skipped for a SkipReason
+var skipDescriptions = map[SkipReason]string{
+	SkipTooLarge:      "exceeds --max-input-file-size",
+	SkipNotUTF8:       "not valid UTF-8",
+	SkipBinary:        "binary",
+	SkipTooManyLines:  "exceeds --max-input-file-lines",
+	SkipTooManyTokens: "exceeds --max-input-file-tokens",
+}
+
+// buildTree returns the tree of sourceEntries, after exclusions, where
+// files are annotated with their lines and size, or why they're skipped.
+// validations are the results of validateSourceEntries.
+func buildTree(rootName string, sourceEntries []sourceEntry, validations []*ValidationResult, errs *errorCollector) *treeNode {
+	root := &treeNode{name: rootName, isDir: true}
+	fileErrors := make(map[string]*BalerError)
+	for _, fileError := range errs.errors {
+		fileErrors[fileError.Path] = fileError.Err
+	}
+	for i, source := range sourceEntries {
+		parts := strings.Split(source.relPath, "/")
+		parent := root
+		for _, part := range parts[:len(parts)-1] {
+			parent = parent.child(part)
+		}
+		name := parts[len(parts)-1]
+		if source.isDir {
+			parent.child(name)
+			continue
+		}
+		node := &treeNode{name: name}
+		switch validationResult := validations[i]; {
+		case validationResult == nil:
+			message := "error"
+			if balerErr, ok := fileErrors[source.relPath]; ok {
+				message = balerErr.Message
+			}
+			node.note = "skipped: " + message
+		case validationResult.Reason() != "":
+			node.note = "skipped: " + skipDescriptions[validationResult.Reason()]
+		default:
+			lines := "lines"
+			if validationResult.Lines == 1 {
+				lines = "line"
+			}
+			node.note = fmt.Sprintf("%d %s, %s", validationResult.Lines, lines, FormatSize(validationResult.Size))
+		}
+		parent.add(node)
+	}
+	return root
+}
+
+// render writes the tree with one line per file or directory, e.g/
+//
+//	project/
+//	|-- cmd/
+//	|   `-- main.go (40 lines, 1.1 KiB)
+//	`-- logo.png (skipped: not valid UTF-8)
+func (n *treeNode) render() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(n.label() + "\n")
+	n.renderChildren(&buffer, "")
+	return buffer.Bytes()
+}
+
+func (n *treeNode) label() string {
+	label := n.name
+	if n.isDir {
+		label += "/"
+	}
+	if n.note != "" {
+		label += " (" + n.note + ")"
+	}
+	return label
+}
+
+func (n *treeNode) renderChildren(buffer *bytes.Buffer, indent string) {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		child := n.children[name]
+		branch, childIndent := "|-- ", "|   "
+		if i == len(names)-1 {
+			branch, childIndent = "`-- ", "    "
+		}
+		// new lines in names would break the tree
+		buffer.WriteString(indent + branch + strings.ReplaceAll(child.label(), "\n", "\\n") + "\n")
+		child.renderChildren(buffer, indent+childIndent)
+	}
+}
@@ -0,0 +1,101 @@
+package baler
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	sourceEntries := []sourceEntry{
+		{relPath: "cmd", isDir: true},
+		{relPath: "cmd/main.go"},
+		{relPath: "empty", isDir: true},
+		{relPath: "README.md"},
+		{relPath: "logo.png"},
+		{relPath: "broken.txt"},
+	}
+	validations := []*ValidationResult{
+		nil,
+		{IsValidUTF8: true, IsValidLines: true, IsValidSize: true, IsValidTokens: true, Size: 1126, Lines: 40},
+		nil,
+		{IsValidUTF8: true, IsValidLines: true, IsValidSize: true, IsValidTokens: true, Size: 345, Lines: 12},
+		{IsValidUTF8: false, IsValidLines: true, IsValidSize: true, IsValidTokens: true, Size: 2048},
+		nil,
+	}
+	errs := newErrorCollector(&BalerConfig{IgnoreErrors: true, Logger: &NoopLogger{}})
+	errs.handle("broken.txt", NewIOError("unable to open: broken.txt", nil))
+
+	expected := strings.Join([]string{
+		"project/",
+		"|-- README.md (12 lines, 345 B)",
+		"|-- broken.txt (skipped: unable to open: broken.txt)",
+		"|-- cmd/",
+		"|   `-- main.go (40 lines, 1.1 KiB)",
+		"|-- empty/",
+		"`-- logo.png (skipped: not valid UTF-8)",
+		"",
+	}, "\n")
+	if tree := string(buildTree("project", sourceEntries, validations, errs).render()); tree != expected {
+		t.Errorf("Unexpected tree\nExpected:\n%s\nGot:\n%s", expected, tree)
+	}
+}
+
+func TestConvertWithTree(t *testing.T) {
+	files := map[string]string{
+		"main.go":          "package main\n",
+		"lib/a.txt":        "// filename: a\n```\n<document path=\"x\">\n",
+		"lib/nested/b.txt": strings.Repeat("b", 600),
+		"big.txt":          strings.Repeat("x", 2000),
+	}
+	for _, format := range []OutputFormat{FormatText, FormatMarkdown, FormatXML, FormatJSONL} {
+		t.Run(string(format), func(t *testing.T) {
+			config := &BalerConfig{
+				MaxInputFileSize:  1024,
+				MaxInputFileLines: 100,
+				MaxOutputFileSize: 2048,
+				ExclusionPatterns: &[]string{},
+				FileDelimiter:     "// filename: ",
+				Format:            format,
+				Tree:              true,
+				Logger:            &NoopLogger{},
+			}
+			destDir := convertTestTree(t, files, config)
+			content, err := os.ReadFile(filepath.Join(destDir, "output_0.txt"))
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if !strings.Contains(string(content), "big.txt (skipped: exceeds --max-input-file-size)") {
+				t.Errorf("Expected the tree in the first output file, got %q", content)
+			}
+
+			unconvertConfig := &BalerConfig{
+				MaxInputFileSize: 4096,
+				FileDelimiter:    "// filename: ",
+				Format:           FormatAuto,
+				Logger:           &NoopLogger{},
+				Operation:        OperationUnconvert,
+			}
+			// without the manifest, the format is detected
+			if err := os.Remove(filepath.Join(destDir, ManifestFileName)); err != nil {
+				t.Fatalf("Failed to remove manifest: %v", err)
+			}
+			unconvertDir := unconvertTestTree(t, destDir, unconvertConfig)
+			restored := 0
+			err = filepath.Walk(unconvertDir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					restored++
+				}
+				return err
+			})
+			if err != nil || restored != 3 {
+				t.Errorf("Expected 3 restored files, got %d, %v", restored, err)
+			}
+			restoredFiles := maps.Clone(files)
+			delete(restoredFiles, "big.txt")
+			assertTestTree(t, unconvertDir, restoredFiles)
+		})
+	}
+}
@@ -0,0 +1,563 @@
+package baler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// isWithin reports whether path is root or inside it
+func isWithin(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// unsafePathReason returns why a path read from baler output can't be written
+// into dst, or "". Output files come back from LLMs, so paths which are
+// absolute, contain '..', or resolve outside a directory opened with NewDirFS
+// through symbolic links are unsafe.
+func unsafePathReason(entryPath string, dst fs.FS) (string, *BalerError) {
+	if entryPath == "" {
+		return "empty path", nil
+	}
+	if path.IsAbs(entryPath) || filepath.IsAbs(entryPath) || filepath.VolumeName(entryPath) != "" {
+		return "absolute path", nil
+	}
+	parts := strings.Split(entryPath, "/")
+	for _, part := range parts {
+		if part == ".." {
+			return "path contains '..'", nil
+		}
+	}
+	dir, ok := dst.(*dirFS)
+	if !ok {
+		// other file systems don't go outside of themselves
+		return "", nil
+	}
+	destinationDir := dir.dir
+	absDestinationDir, err := filepath.Abs(destinationDir)
+	if err != nil {
+		return "", NewIOError(fmt.Sprintf("unable to get absolute path for %s", destinationDir), err)
+	}
+	root, err := filepath.EvalSymlinks(absDestinationDir)
+	if err != nil {
+		return "", NewIOError(fmt.Sprintf("unable to resolve %s", destinationDir), err)
+	}
+	// symbolic links are resolved up to the first missing part of the path,
+	// which is then created inside the resolved directory
+	current := root
+	for i, part := range parts {
+		next := filepath.Join(current, part)
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+			break
+		} else if err != nil {
+			return "", NewIOError(fmt.Sprintf("unable to get information on %s", next), err)
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			resolved, err := filepath.EvalSymlinks(next)
+			if errors.Is(err, fs.ErrNotExist) {
+				// a dangling link is followed when writing
+				target, err := os.Readlink(next)
+				if err != nil {
+					return "", NewIOError(fmt.Sprintf("unable to read link %s", next), err)
+				}
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(current, target)
+				}
+				resolved = filepath.Clean(target)
+			} else if err != nil {
+				return "", NewIOError(fmt.Sprintf("unable to resolve %s", next), err)
+			}
+			if !isWithin(root, resolved) {
+				return fmt.Sprintf("%s links outside the destination directory", strings.Join(parts[:i+1], "/")), nil
+			}
+			next = resolved
+		} else if !info.IsDir() {
+			// a file among the parents is a conflict, not an escape
+			break
+		}
+		current = next
+	}
+	return "", nil
+}
+
+// checkEntryPath fails on unsafe paths, or reports them as skipped with
+// SkipUnsafePaths
+func checkEntryPath(entryPath string, fsys fs.FS, config *BalerConfig) (bool, *BalerError) {
+	reason, balerErr := unsafePathReason(entryPath, fsys)
+	if balerErr != nil || reason == "" {
+		return false, balerErr
+	}
+	if !config.SkipUnsafePaths {
+		return false, NewValidationError(fmt.Sprintf("unsafe path %q: %s", entryPath, reason), nil)
+	}
+	config.Logger.Warn("Skipping unsafe path", "path", entryPath, "reason", reason)
+	return true, nil
+}
+
+// writeEntry writes a file read from baler output into destinationDir
+func writeEntry(entry *bundleEntry, destinationDir string) *BalerError {
+	destinationPath := filepath.Join(destinationDir, filepath.FromSlash(entry.Path))
+	if err := os.MkdirAll(filepath.Dir(destinationPath), 0755); err != nil {
+		return NewIOError(
+			fmt.Sprintf("failed to create directory for path: %s", destinationPath),
+			err,
+		)
+	}
+	// permissions are only restored by formats which store them
+	mode := entry.Mode.Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.WriteFile(destinationPath, entry.Content, mode); err != nil {
+		return NewIOError(
+			fmt.Sprintf("failed to write to file: %s", entry.Path),
+			err,
+		)
+	}
+	// existing files keep their permissions with os.WriteFile
+	if entry.Mode != 0 {
+		if err := os.Chmod(destinationPath, mode); err != nil {
+			return NewIOError(
+				fmt.Sprintf("failed to set permissions of file: %s", entry.Path),
+				err,
+			)
+		}
+	}
+	return nil
+}
+
+// BundleReader reads the output files of Convert. It's only created by
+// NewFSBundleReader, NewDirBundleReader and NewStreamBundleReader, the zero
+// value isn't usable.
+type BundleReader struct {
+	bundleSource
+}
+
+// bundleSource is implemented by the readers of output files
+type bundleSource interface {
+	// manifest returns the manifest of the bundle, or nil without one
+	manifest() (*Manifest, *BalerError)
+	// read calls emit for every file of the bundle
+	read(config *BalerConfig, errs *errorCollector, emit func(entry *bundleEntry) *BalerError) *BalerError
+}
+
+// fsBundleReader reads the output files in the root of a file system
+type fsBundleReader struct {
+	fsys fs.FS
+}
+
+// NewFSBundleReader returns a BundleReader for the output files in the
+// root of fsys, e.g/ an embed.FS or a zip file. The manifest of the bundle
+// is used when there is one.
+func NewFSBundleReader(fsys fs.FS) BundleReader {
+	return BundleReader{&fsBundleReader{fsys: fsys}}
+}
+
+// NewDirBundleReader returns a BundleReader for the output files in dir
+func NewDirBundleReader(dir string) BundleReader {
+	return BundleReader{&fsBundleReader{fsys: NewDirFS(dir)}}
+}
+
+func (r *fsBundleReader) manifest() (*Manifest, *BalerError) {
+	return ReadManifest(r.fsys)
+}
+
+func (r *fsBundleReader) read(config *BalerConfig, errs *errorCollector, emit func(entry *bundleEntry) *BalerError) *BalerError {
+	if balerErr := checkDirectory(r.fsys, "source directory"); balerErr != nil {
+		return balerErr
+	}
+	entries, err := fs.ReadDir(r.fsys, ".")
+	if err != nil {
+		return NewValidationError(
+			fmt.Sprintf("unable to list source directory: %s", displayPath(r.fsys, ".")),
+			err,
+		)
+	}
+	if len(entries) == 0 {
+		return NewValidationError("no files to process", nil)
+	}
+	manifest, balerErr := r.manifest()
+	if balerErr != nil {
+		return balerErr
+	}
+	var sourceNames []string
+	// checksums of the files listed in the manifest
+	checksums := make(map[string]string)
+	if manifest != nil {
+		// the manifest knows the output files and how they were written
+		if config.Verbose {
+			config.Logger.Info("Using manifest", "path", displayPath(r.fsys, ManifestFileName))
+		}
+		sourceNames = append(sourceNames, manifest.OutputFiles...)
+		for _, file := range manifest.Files {
+			checksums[file.Path] = file.SHA256
+		}
+		if config.Format == FormatAuto && manifest.Config.Format != "" {
+			manifestConfig := *config
+			manifestConfig.Format = manifest.Config.Format
+			if manifest.Config.Delimiter != "" {
+				manifestConfig.FileDelimiter = manifest.Config.Delimiter
+			}
+			config = &manifestConfig
+		}
+	} else {
+		for _, entry := range entries {
+			sourceNames = append(sourceNames, entry.Name())
+		}
+	}
+	parser, balerErr := newBundleParser(config)
+	if balerErr != nil {
+		return balerErr
+	}
+	for _, name := range sourceNames {
+		sourcePath := displayPath(r.fsys, name)
+		file, err := r.fsys.Open(name)
+		if err != nil {
+			balerErr := NewIOError(
+				fmt.Sprintf("failed to open source file: %s", sourcePath),
+				err,
+			)
+			if balerErr = errs.handle(path.Base(name), balerErr); balerErr != nil {
+				return balerErr
+			}
+			continue
+		}
+		balerErr := parser.parse(sourcePath, file, func(entry *bundleEntry) *BalerError {
+			if expected, ok := checksums[entry.Path]; ok && expected != checksum(entry.Content) {
+				config.Logger.Warn("Checksum mismatch with the manifest", "path", entry.Path, "output_file", sourcePath)
+			}
+			return emit(entry)
+		})
+		file.Close()
+		if balerErr != nil {
+			// entries of the output file before the error were emitted
+			if balerErr = errs.handle(path.Base(name), balerErr); balerErr != nil {
+				return balerErr
+			}
+			continue
+		}
+		if config.Verbose {
+			config.Logger.Info("Processed output file", "output_file", sourcePath)
+		}
+	}
+	return nil
+}
+
+// streamBundleReader reads output files concatenated in a single stream
+type streamBundleReader struct {
+	reader io.Reader
+}
+
+// NewStreamBundleReader returns a BundleReader for output files concatenated
+// in a single stream, e.g/ os.Stdin or the output of NewStreamBundleWriter
+func NewStreamBundleReader(reader io.Reader) BundleReader {
+	return BundleReader{&streamBundleReader{reader: reader}}
+}
+
+func (r *streamBundleReader) manifest() (*Manifest, *BalerError) {
+	return nil, nil
+}
+
+func (r *streamBundleReader) read(config *BalerConfig, errs *errorCollector, emit func(entry *bundleEntry) *BalerError) *BalerError {
+	parser, balerErr := newBundleParser(config)
+	if balerErr != nil {
+		return balerErr
+	}
+	return parser.parse("stream", r.reader, emit)
+}
+
+// copyFile copies a file along with its permissions, creating the
+// parent directories of destinationPath
+func copyFile(sourcePath string, destinationPath string) *BalerError {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return NewIOError(fmt.Sprintf("unable to get information on %s", sourcePath), err)
+	}
+	content, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return NewIOError(fmt.Sprintf("unable to read: %s", sourcePath), err)
+	}
+	if err := os.MkdirAll(filepath.Dir(destinationPath), 0755); err != nil {
+		return NewIOError(fmt.Sprintf("failed to create directory for path: %s", destinationPath), err)
+	}
+	if err := os.WriteFile(destinationPath, content, info.Mode().Perm()); err != nil {
+		return NewIOError(fmt.Sprintf("failed to write to file: %s", destinationPath), err)
+	}
+	// existing files keep their permissions with os.WriteFile
+	if err := os.Chmod(destinationPath, info.Mode().Perm()); err != nil {
+		return NewIOError(fmt.Sprintf("failed to set permissions of file: %s", destinationPath), err)
+	}
+	return nil
+}
+
+// copyMode sets the permissions of destinationPath to the ones of sourcePath
+func copyMode(sourcePath string, destinationPath string) *BalerError {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return NewIOError(fmt.Sprintf("unable to get information on %s", sourcePath), err)
+	}
+	if err := os.Chmod(destinationPath, info.Mode().Perm()); err != nil {
+		return NewIOError(fmt.Sprintf("failed to set permissions of file: %s", destinationPath), err)
+	}
+	return nil
+}
+
+// appliedFile is a file moved into place by applyPlan, to roll it back
+type appliedFile struct {
+	destinationPath string
+	// empty for files which didn't exist
+	backupPath string
+}
+
+// rollback restores overwritten files from their backup and removes
+// created files and directories, in reverse order
+func rollback(applied []appliedFile, createdDirs []string, config *BalerConfig) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		file := applied[i]
+		var err error
+		if file.backupPath == "" {
+			err = os.Remove(file.destinationPath)
+		} else if balerErr := copyFile(file.backupPath, file.destinationPath); balerErr != nil {
+			err = balerErr
+		}
+		if err != nil {
+			config.Logger.Error("Unable to roll back file", "path", file.destinationPath, "error", err)
+		}
+	}
+	// removing a directory only succeeds when it's empty
+	for i := len(createdDirs) - 1; i >= 0; i-- {
+		os.Remove(createdDirs[i])
+	}
+}
+
+// createParentDirs creates the missing parents of path, and returns them
+// from the outermost to the innermost
+func createParentDirs(path string) ([]string, *BalerError) {
+	var missing []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append([]string{dir}, missing...)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for _, dir := range missing {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return nil, NewIOError(fmt.Sprintf("failed to create directory: %s", dir), err)
+		}
+	}
+	return missing, nil
+}
+
+// applyPlan writes every file of plan into a staging directory inside
+// destinationDir, then renames them into place. Overwritten files are
+// copied into a backup directory first, and restored when a file can't
+// be moved into place, or ctx is done.
+func applyPlan(ctx context.Context, plan *UnconvertPlan, destinationDir string, config *BalerConfig, progress *progressTracker) *BalerError {
+	// inside destinationDir, so that files are renamed on the same file system
+	stagingDir, err := os.MkdirTemp(destinationDir, ".baler-staging-")
+	if err != nil {
+		return NewIOError(fmt.Sprintf("unable to create staging directory in %s", destinationDir), err)
+	}
+	defer os.RemoveAll(stagingDir)
+	backupDir := config.BackupDir
+	if backupDir == "" {
+		backupDir, err = os.MkdirTemp(destinationDir, ".baler-backup-")
+		if err != nil {
+			return NewIOError(fmt.Sprintf("unable to create backup directory in %s", destinationDir), err)
+		}
+		defer os.RemoveAll(backupDir)
+	} else if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return NewIOError(fmt.Sprintf("unable to create backup directory: %s", backupDir), err)
+	}
+
+	var pending []PlannedFile
+	for _, planned := range plan.Files {
+		if balerErr := checkCanceled(ctx); balerErr != nil {
+			return balerErr
+		}
+		switch planned.Action {
+		case PlanCreate, PlanOverwrite:
+			if balerErr := writeEntry(planned.entry, stagingDir); balerErr != nil {
+				return balerErr
+			}
+			pending = append(pending, planned)
+		default:
+			skipPlanned(planned, config, progress)
+		}
+	}
+
+	var applied []appliedFile
+	var createdDirs []string
+	for _, planned := range pending {
+		if balerErr := checkCanceled(ctx); balerErr != nil {
+			rollback(applied, createdDirs, config)
+			return balerErr
+		}
+		stagedPath := filepath.Join(stagingDir, filepath.FromSlash(planned.Path))
+		destinationPath := filepath.Join(destinationDir, filepath.FromSlash(planned.Path))
+		file := appliedFile{destinationPath: destinationPath}
+		if planned.Action == PlanOverwrite {
+			file.backupPath = filepath.Join(backupDir, filepath.FromSlash(planned.Path))
+			if balerErr := copyFile(destinationPath, file.backupPath); balerErr != nil {
+				rollback(applied, createdDirs, config)
+				return balerErr
+			}
+			// existing files keep their permissions, unless the format stores them
+			if planned.entry.Mode == 0 {
+				if balerErr := copyMode(file.backupPath, stagedPath); balerErr != nil {
+					rollback(applied, createdDirs, config)
+					return balerErr
+				}
+			}
+		} else {
+			dirs, balerErr := createParentDirs(destinationPath)
+			createdDirs = append(createdDirs, dirs...)
+			if balerErr != nil {
+				rollback(applied, createdDirs, config)
+				return balerErr
+			}
+		}
+		if err := os.Rename(stagedPath, destinationPath); err != nil {
+			rollback(applied, createdDirs, config)
+			return NewIOError(fmt.Sprintf("failed to move %s into place", planned.Path), err)
+		}
+		applied = append(applied, file)
+		wrotePlanned(planned, config, progress)
+	}
+	return nil
+}
+
+// wrotePlanned records a file of the plan which was written
+func wrotePlanned(planned PlannedFile, config *BalerConfig, progress *progressTracker) {
+	if config.Verbose {
+		config.Logger.Info("Wrote file", "path", planned.Path, "action", planned.Action, "size", planned.Size)
+	}
+	config.Report.include(ReportFile{Path: planned.Path, Size: planned.Size, Action: planned.Action})
+	progress.written(planned.Path, planned.Size)
+}
+
+// skipPlanned records a file of the plan which isn't written, conflicts
+// are recorded as errors by UnConvert
+func skipPlanned(planned PlannedFile, config *BalerConfig, progress *progressTracker) {
+	switch planned.Action {
+	case PlanUnchanged:
+		if config.Verbose {
+			config.Logger.Info("Skipping unchanged file", "path", planned.Path, "size", planned.Size)
+		}
+		config.Report.skip(planned.Path, SkipUnchanged, uint64(planned.Size), "")
+	case PlanSkip:
+		config.Report.skip(planned.Path, SkipUnsafePath, 0, planned.Reason)
+	}
+	progress.skipped(planned.Path)
+}
+
+// writePlan writes every file of plan into dst one after the other, for
+// file systems other than directories opened with NewDirFS. Files written
+// before an error are kept.
+func writePlan(ctx context.Context, plan *UnconvertPlan, dst WritableFS, config *BalerConfig, progress *progressTracker) *BalerError {
+	for _, planned := range plan.Files {
+		if balerErr := checkCanceled(ctx); balerErr != nil {
+			return balerErr
+		}
+		if planned.Action != PlanCreate && planned.Action != PlanOverwrite {
+			skipPlanned(planned, config, progress)
+			continue
+		}
+		name := fsName(planned.Path)
+		if err := dst.MkdirAll(path.Dir(name), 0755); err != nil {
+			return NewIOError(fmt.Sprintf("failed to create directory for path: %s", planned.Path), err)
+		}
+		// existing files keep their permissions, unless the format stores them
+		mode := planned.entry.Mode.Perm()
+		if mode == 0 {
+			mode = planned.previousMode
+		}
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := dst.WriteFile(name, planned.entry.Content, mode); err != nil {
+			return NewIOError(fmt.Sprintf("failed to write to file: %s", planned.Path), err)
+		}
+		wrotePlanned(planned, config, progress)
+	}
+	return nil
+}
+
+// UnConvert writes the files of the bundle src into dst. Nothing is written
+// when a file conflicts with dst, unless config.IgnoreErrors is set. Files
+// are written atomically into directories opened with NewDirFS, and
+// overwritten files are restored when one can't be moved into place.
+func UnConvert(ctx context.Context, src BundleReader, dst WritableFS, config *BalerConfig) *BalerError {
+	config.Report.start(OperationUnconvert)
+	balerErr := unConvert(ctx, src, dst, config)
+	config.Report.finish(balerErr)
+	return balerErr
+}
+
+// checkConflicts fails when a file of the plan conflicts, with IgnoreErrors
+// the conflicting files are collected by errs and left out
+func checkConflicts(plan *UnconvertPlan, config *BalerConfig, errs *errorCollector) *BalerError {
+	if config.IgnoreErrors {
+		for _, planned := range plan.Files {
+			if planned.Action == PlanConflict {
+				errs.handle(planned.Path, NewValidationError(planned.Reason, nil))
+			}
+		}
+		return nil
+	}
+	conflicts := plan.Count(PlanConflict)
+	if conflicts == 0 {
+		return nil
+	}
+	// nothing is written when any file conflicts
+	for _, planned := range plan.Files {
+		if planned.Action == PlanConflict {
+			return NewValidationError(
+				fmt.Sprintf("%d file(s) can't be written, e.g/ %s: %s", conflicts, planned.Path, planned.Reason),
+				nil,
+			)
+		}
+	}
+	return nil
+}
+
+func unConvert(ctx context.Context, src BundleReader, dst WritableFS, config *BalerConfig) *BalerError {
+	errs := newErrorCollector(config)
+	plan, balerErr := planUnConvert(ctx, src, dst, config, errs)
+	if balerErr != nil {
+		return balerErr
+	}
+	config.Report.scanned()
+	if balerErr := checkConflicts(plan, config, errs); balerErr != nil {
+		return balerErr
+	}
+	progress := newProgressTracker(config, OperationUnconvert, len(plan.Files))
+	if dir, ok := dst.(*dirFS); ok {
+		balerErr = applyPlan(ctx, plan, dir.dir, config, progress)
+	} else {
+		balerErr = writePlan(ctx, plan, dst, config, progress)
+	}
+	if balerErr != nil {
+		return balerErr
+	}
+	config.Report.written()
+	return errs.result()
+}
+
+// UnConvertDir writes the files of the output files in sourceDir into
+// destinationDir, see UnConvert
+func UnConvertDir(ctx context.Context, sourceDir string, destinationDir string, config *BalerConfig) *BalerError {
+	return UnConvert(ctx, NewDirBundleReader(sourceDir), NewDirFS(destinationDir), config)
+}
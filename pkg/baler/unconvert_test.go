@@ -0,0 +1,248 @@
+package baler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestUnsafePathReason(t *testing.T) {
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+	outsideDir, outsideCleanup := setupTestDir(t)
+	defer outsideCleanup()
+
+	if err := os.Mkdir(filepath.Join(destDir, "inside"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	links := map[string]string{
+		"outside_link":  outsideDir,
+		"relative_link": "../" + filepath.Base(outsideDir),
+		"inside_link":   filepath.Join(destDir, "inside"),
+		"dangling_link": filepath.Join(outsideDir, "missing"),
+		"file_link":     filepath.Join(outsideDir, "file.txt"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(destDir, name)); err != nil {
+			t.Skipf("Symbolic links aren't supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		unsafe bool
+	}{
+		{name: "Relative path", path: "dir/file.txt", unsafe: false},
+		{name: "Empty path", path: "", unsafe: true},
+		{name: "Parent directory", path: "../escape.txt", unsafe: true},
+		{name: "Nested parent directory", path: "dir/../../escape.txt", unsafe: true},
+		{name: "Parent directory inside", path: "dir/../file.txt", unsafe: true},
+		{name: "Absolute path", path: "/etc/passwd", unsafe: true},
+		{name: "Link outside", path: "outside_link/authorized_keys", unsafe: true},
+		{name: "Relative link outside", path: "relative_link/file.txt", unsafe: true},
+		{name: "Dangling link outside", path: "dangling_link/file.txt", unsafe: true},
+		{name: "File link outside", path: "file_link", unsafe: true},
+		{name: "Link inside", path: "inside_link/file.txt", unsafe: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, balerErr := unsafePathReason(tt.path, NewDirFS(destDir))
+			if balerErr != nil {
+				t.Fatalf("Unexpected error: %v", balerErr)
+			}
+			if unsafe := reason != ""; unsafe != tt.unsafe {
+				t.Errorf("Expected unsafe %v for %q, got reason %q", tt.unsafe, tt.path, reason)
+			}
+		})
+	}
+}
+
+func TestUnConvertUnsafePaths(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	parentDir, parentCleanup := setupTestDir(t)
+	defer parentCleanup()
+	destDir := filepath.Join(parentDir, "dest")
+	if err := os.Mkdir(destDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	createTestFile(t, sourceDir, "output_0.txt",
+		"// filename: safe.txt\nsafe\n\n// filename: ../escape.txt\nescape\n\n")
+	config := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatText,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	balerErr := UnConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr == nil || balerErr.Type != ErrorTypeValidation {
+		t.Fatalf("Expected a validation error, got %v", balerErr)
+	}
+	for _, path := range []string{filepath.Join(destDir, "safe.txt"), filepath.Join(parentDir, "escape.txt")} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("Expected %s not to be written", path)
+		}
+	}
+
+	config.SkipUnsafePaths = true
+	if balerErr := UnConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	if content, err := os.ReadFile(filepath.Join(destDir, "safe.txt")); err != nil || string(content) != "safe\n" {
+		t.Errorf("Expected safe.txt to be written, got %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(parentDir, "escape.txt")); err == nil {
+		t.Error("Expected escape.txt to be skipped")
+	}
+}
+
+func TestUnConvertBackupAndRollback(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+	backupDir, backupCleanup := setupTestDir(t)
+	defer backupCleanup()
+
+	createTestFile(t, sourceDir, "output_0.txt",
+		"// filename: a.txt\nnew a\n\n// filename: dir/b.txt\nnew b\n\n")
+	createTestFile(t, destDir, "a.txt", "old a\n")
+	if err := os.Chmod(filepath.Join(destDir, "a.txt"), 0600); err != nil {
+		t.Fatalf("Failed to set permissions: %v", err)
+	}
+	config := &BalerConfig{
+		MaxInputFileSize: 4096,
+		FileDelimiter:    "// filename: ",
+		Format:           FormatText,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+		BackupDir:        filepath.Join(backupDir, "backup"),
+	}
+	if balerErr := UnConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Unconvert failed: %v", balerErr)
+	}
+	expected := map[string]string{
+		filepath.Join(destDir, "a.txt"):                 "new a\n",
+		filepath.Join(destDir, "dir", "b.txt"):          "new b\n",
+		filepath.Join(config.BackupDir, "a.txt"):        "old a\n",
+		filepath.Join(config.BackupDir, "dir", "b.txt"): "",
+	}
+	for path, expectedContent := range expected {
+		content, err := os.ReadFile(path)
+		if expectedContent == "" {
+			if err == nil {
+				t.Errorf("Expected %s not to exist", path)
+			}
+			continue
+		}
+		if err != nil || string(content) != expectedContent {
+			t.Errorf("Content mismatch for %s\nExpected: %q\nGot: %q", path, expectedContent, content)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(destDir, "a.txt")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a.txt to keep its permissions, got %v", info.Mode().Perm())
+	}
+	// staging and temporary backup directories are removed
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("Failed to read destination directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected only a.txt and dir in destination directory, got %v", entries)
+	}
+
+	// a file which can't be moved into place rolls back the files before it
+	createTestFile(t, destDir, "c.txt", "a file where a directory is expected\n")
+	plan := &UnconvertPlan{Files: []PlannedFile{
+		{Path: "a.txt", Action: PlanOverwrite, entry: &bundleEntry{Path: "a.txt", Content: []byte("newer a\n")}},
+		{Path: "new.txt", Action: PlanCreate, entry: &bundleEntry{Path: "new.txt", Content: []byte("new\n")}},
+		{Path: "c.txt/d.txt", Action: PlanCreate, entry: &bundleEntry{Path: "c.txt/d.txt", Content: []byte("d\n")}},
+	}}
+	config.BackupDir = ""
+	if balerErr := applyPlan(context.Background(), plan, destDir, config, newProgressTracker(config, OperationUnconvert, len(plan.Files))); balerErr == nil {
+		t.Fatal("Expected applyPlan to fail")
+	}
+	if content, err := os.ReadFile(filepath.Join(destDir, "a.txt")); err != nil || string(content) != "new a\n" {
+		t.Errorf("Expected a.txt to be rolled back, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "new.txt")); err == nil {
+		t.Error("Expected new.txt to be removed")
+	}
+	entries, err = os.ReadDir(destDir)
+	if err != nil {
+		t.Fatalf("Failed to read destination directory: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected only a.txt, c.txt and dir in destination directory, got %v", entries)
+	}
+}
+
+func TestUnConvertIgnoreErrors(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+
+	createTestFile(t, sourceDir, "output_0.jsonl",
+		`{"path":"a.txt","content":"a\n"}`+"\n"+
+			`{"path":"../escape.txt","content":"escape\n"}`+"\n"+
+			`{"path":"dir","content":"conflict\n"}`+"\n")
+	createTestFile(t, sourceDir, "output_1.jsonl",
+		`{"path":"b.txt","content":"b\n"}`+"\n"+"not json\n"+`{"path":"c.txt","content":"c\n"}`+"\n")
+	if err := os.Mkdir(filepath.Join(destDir, "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	config := &BalerConfig{
+		MaxInputFileSize: 4096,
+		Format:           FormatJSONL,
+		Logger:           &NoopLogger{},
+		Operation:        OperationUnconvert,
+	}
+	if balerErr := UnConvertDir(context.Background(), sourceDir, destDir, config); balerErr == nil || balerErr.Type != ErrorTypeValidation {
+		t.Fatalf("Expected a validation error, got %v", balerErr)
+	}
+
+	config.IgnoreErrors = true
+	balerErr := UnConvertDir(context.Background(), sourceDir, destDir, config)
+	if balerErr == nil || balerErr.Type != ErrorTypePartial {
+		t.Fatalf("Expected a partial error, got %v", balerErr)
+	}
+	var multiErr *MultiError
+	if !errors.As(balerErr, &multiErr) {
+		t.Fatalf("Expected a MultiError, got %v", balerErr)
+	}
+	paths := []string{}
+	for _, fileError := range multiErr.Errors {
+		paths = append(paths, fileError.Path)
+	}
+	sort.Strings(paths)
+	expectedPaths := []string{"../escape.txt", "dir", "output_1.jsonl"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Expected errors for %v, got %v", expectedPaths, paths)
+	}
+	expected := map[string]string{
+		"a.txt": "a\n",
+		// written before the invalid record
+		"b.txt": "b\n",
+		"c.txt": "",
+	}
+	for path, expectedContent := range expected {
+		content, err := os.ReadFile(filepath.Join(destDir, path))
+		if expectedContent == "" {
+			if err == nil {
+				t.Errorf("Expected %s not to exist", path)
+			}
+			continue
+		}
+		if err != nil || string(content) != expectedContent {
+			t.Errorf("Expected %q in %s, got %q, %v", expectedContent, path, content, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package baler
+
+// logger, args are alternating keys and values of structured attributes
+// as with log/slog, e.g/ Info("Skipping file", "path", path, "reason", reason).
+// *slog.Logger implements it.
+type Logger interface {
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+type NoopLogger struct{}
+
+func (l *NoopLogger) Info(msg string, args ...any)  {}
+func (l *NoopLogger) Warn(msg string, args ...any)  {}
+func (l *NoopLogger) Error(msg string, args ...any) {}
+
+// baler config
+type OperationType string
+
+const (
+	OperationConvert   OperationType = "convert"
+	OperationUnconvert OperationType = "unconvert"
+	OperationVerify    OperationType = "verify"
+)
+
+// TODO: with Logger it should be refactored to an App
+// with config, logger
+type BalerConfig struct {
+	MaxInputFileLines uint64
+	MaxInputFileSize  uint64
+	MaxOutputFileSize uint64
+	MaxBufferSize     uint64
+	// token limits are only applied with a Tokenizer, 0 disables them
+	MaxInputFileTokens uint64
+	MaxOutputTokens    uint64
+	ExclusionPatterns  *[]string
+	// when not empty, only files matching one of these are converted
+	IncludePatterns *[]string
+	// names of .gitignore style files honored while converting
+	// e.g/ ".gitignore", ".balerignore"
+	IgnoreFileNames *[]string
+	Operation       OperationType
+	FileDelimiter   string
+	Format          OutputFormat
+	// order of the files in the output files, "" defaults to OrderPath
+	Order FileOrder
+	// files matching these come first, in the order of the patterns
+	PriorityPatterns *[]string
+	// writes a directory tree at the beginning of the first output file
+	Tree bool
+	// files read and validated concurrently, 0 defaults to the number of CPUs
+	Jobs int
+	// replace the output files of a previous convert, listed by its manifest
+	Overwrite bool
+	// skip files which can't be processed, and return a partial error
+	IgnoreErrors bool
+	// skip files with unsafe paths while unconverting, instead of failing
+	SkipUnsafePaths bool
+	// keeps a copy of the files overwritten while unconverting
+	BackupDir string
+	Verbose   bool
+	// baler app attribute(s)
+	// TODO: move
+	Logger    Logger
+	Tokenizer Tokenizer
+	// notified of the files handled, nil disables it
+	Progress ProgressObserver
+	// filled with the files handled and skipped, nil disables it
+	Report *Report
+	// output of ConvertDir when it's inside the input, never converted
+	outputPaths map[string]bool
+}
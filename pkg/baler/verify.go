@@ -0,0 +1,160 @@
+package baler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+type VerifyStatus string
+
+const (
+	// VerifyAdded files are in the bundle, but not in the source directory
+	VerifyAdded VerifyStatus = "added"
+	// VerifyRemoved files would be converted from the source directory,
+	// but are missing from the bundle
+	VerifyRemoved   VerifyStatus = "removed"
+	VerifyModified  VerifyStatus = "modified"
+	VerifyUnchanged VerifyStatus = "unchanged"
+)
+
+// VerifyResult compares a file of a bundle with the source directory
+type VerifyResult struct {
+	Path   string
+	Status VerifyStatus
+	// SHA-256 of the file in the bundle and in the source directory,
+	// empty when the file is missing from either
+	BundleSHA256 string
+	SourceSHA256 string
+}
+
+type VerifyReport struct {
+	// sorted by path
+	Results []VerifyResult
+}
+
+// HasDrift reports whether the bundle differs from the source directory
+func (r *VerifyReport) HasDrift() bool {
+	for _, result := range r.Results {
+		if result.Status != VerifyUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of files with a status
+func (r *VerifyReport) Count(status VerifyStatus) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// fileChecksum returns the SHA-256 of a file, or "" if it doesn't exist
+func fileChecksum(fsys fs.FS, name string) (string, *BalerError) {
+	content, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", NewIOError(fmt.Sprintf("unable to read: %s", displayPath(fsys, name)), err)
+	}
+	return checksum(content), nil
+}
+
+// Verify compares the bundle src with the files of source. Files of source
+// are selected with the rules of Convert, taken from the manifest of the
+// bundle when there is one, so files which were skipped while converting
+// aren't reported as removed.
+func Verify(ctx context.Context, src BundleReader, source fs.FS, config *BalerConfig) (*VerifyReport, *BalerError) {
+	if balerErr := checkDirectory(source, "source directory"); balerErr != nil {
+		return nil, balerErr
+	}
+	manifest, balerErr := src.manifest()
+	if balerErr != nil {
+		return nil, balerErr
+	}
+	sourceConfig := config
+	if manifest != nil {
+		sourceConfig = manifest.convertConfig(config)
+	}
+	// output files are larger than the files they contain
+	bundleConfig := *config
+	if bundleConfig.MaxOutputFileSize > bundleConfig.MaxInputFileSize {
+		bundleConfig.MaxInputFileSize = bundleConfig.MaxOutputFileSize
+	}
+
+	errs := newErrorCollector(config)
+	bundleChecksums := make(map[string]string)
+	balerErr = src.read(&bundleConfig, errs, func(entry *bundleEntry) *BalerError {
+		bundleChecksums[entry.Path] = checksum(entry.Content)
+		return nil
+	})
+	if balerErr != nil {
+		return nil, balerErr
+	}
+
+	report := &VerifyReport{}
+	sourceEntries, balerErr := collectSourceEntries(ctx, source, sourceConfig, errs)
+	if balerErr != nil {
+		return nil, balerErr
+	}
+	for _, entry := range sourceEntries {
+		if entry.isDir {
+			continue
+		}
+		path := entry.relPath
+		if _, ok := bundleChecksums[path]; ok {
+			// compared below, whether it passes validation or not
+			continue
+		}
+		validationResult, balerErr := validateFile(source, path, sourceConfig)
+		if balerErr != nil {
+			if balerErr = errs.handle(path, balerErr); balerErr != nil {
+				return nil, balerErr
+			}
+			continue
+		}
+		if !validationResult.isValid() {
+			if config.Verbose {
+				config.Logger.Info("Skipping file which wouldn't be converted", "path", path, "reason", validationResult.Reason())
+			}
+			continue
+		}
+		sourceChecksum, balerErr := fileChecksum(source, path)
+		if balerErr != nil {
+			return nil, balerErr
+		}
+		report.Results = append(report.Results, VerifyResult{Path: path, Status: VerifyRemoved, SourceSHA256: sourceChecksum})
+	}
+	for path, bundleChecksum := range bundleChecksums {
+		if skip, balerErr := checkEntryPath(path, source, config); balerErr != nil {
+			return nil, balerErr
+		} else if skip {
+			continue
+		}
+		sourceChecksum, balerErr := fileChecksum(source, fsName(path))
+		if balerErr != nil {
+			return nil, balerErr
+		}
+		result := VerifyResult{Path: path, BundleSHA256: bundleChecksum, SourceSHA256: sourceChecksum}
+		switch sourceChecksum {
+		case "":
+			result.Status = VerifyAdded
+		case bundleChecksum:
+			result.Status = VerifyUnchanged
+		default:
+			result.Status = VerifyModified
+		}
+		report.Results = append(report.Results, result)
+	}
+	sort.Slice(report.Results, func(i, j int) bool {
+		return report.Results[i].Path < report.Results[j].Path
+	})
+	return report, errs.result()
+}
@@ -0,0 +1,91 @@
+package baler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	sourceDir, sourceCleanup := setupTestDir(t)
+	defer sourceCleanup()
+	destDir, destCleanup := setupTestDir(t)
+	defer destCleanup()
+
+	createTestFile(t, sourceDir, "same.go", "package same\n")
+	createTestFile(t, sourceDir, "edited.go", "package edited\n")
+	createTestFile(t, sourceDir, "deleted.go", "package deleted\n")
+	createTestFile(t, sourceDir, "large.txt", strings.Repeat("a", 2048))
+	createTestFile(t, sourceDir, "skipped.log", "log\n")
+
+	config := &BalerConfig{
+		MaxInputFileSize:  1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{"*.log"},
+		FileDelimiter:     "// filename: ",
+		Logger:            &NoopLogger{},
+	}
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+
+	createTestFile(t, sourceDir, "edited.go", "package edited\n\nfunc f() {}\n")
+	createTestFile(t, sourceDir, "new.go", "package new\n")
+	if err := os.Remove(filepath.Join(sourceDir, "deleted.go")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	// the exclusions of the manifest apply, not the ones of verify
+	verifyConfig := &BalerConfig{
+		MaxInputFileSize:  1024 * 1024,
+		MaxInputFileLines: 100,
+		MaxOutputFileSize: 4096,
+		ExclusionPatterns: &[]string{},
+		FileDelimiter:     "// filename: ",
+		Format:            FormatAuto,
+		Logger:            &NoopLogger{},
+		Operation:         OperationVerify,
+	}
+	report, balerErr := Verify(context.Background(), NewDirBundleReader(destDir), NewDirFS(sourceDir), verifyConfig)
+	if balerErr != nil {
+		t.Fatalf("Verify failed: %v", balerErr)
+	}
+	expected := map[string]VerifyStatus{
+		"deleted.go": VerifyAdded,
+		"edited.go":  VerifyModified,
+		"new.go":     VerifyRemoved,
+		"same.go":    VerifyUnchanged,
+	}
+	if len(report.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), report.Results)
+	}
+	for _, result := range report.Results {
+		if status, ok := expected[result.Path]; !ok || status != result.Status {
+			t.Errorf("Expected status %q for %s, got %q", status, result.Path, result.Status)
+		}
+		if result.Status == VerifyModified && (result.BundleSHA256 == "" || result.BundleSHA256 == result.SourceSHA256) {
+			t.Errorf("Expected different checksums for %s, got %+v", result.Path, result)
+		}
+	}
+	if !report.HasDrift() {
+		t.Error("Expected drift to be reported")
+	}
+
+	// a fresh bundle has no drift
+	if err := os.RemoveAll(destDir); err != nil || os.Mkdir(destDir, 0755) != nil {
+		t.Fatalf("Failed to recreate destination directory: %v", err)
+	}
+	if _, balerErr := ConvertDir(context.Background(), sourceDir, destDir, config); balerErr != nil {
+		t.Fatalf("Convert failed: %v", balerErr)
+	}
+	report, balerErr = Verify(context.Background(), NewDirBundleReader(destDir), NewDirFS(sourceDir), verifyConfig)
+	if balerErr != nil {
+		t.Fatalf("Verify failed: %v", balerErr)
+	}
+	if report.HasDrift() {
+		t.Errorf("Expected no drift, got %+v", report.Results)
+	}
+}